@@ -0,0 +1,107 @@
+// Package analysis computes training metrics from the streams returned by
+// StreamsService, so they can be derived locally for any activity regardless of
+// what Strava reports on the summary objects.
+package analysis
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/guisaez/gostrava"
+)
+
+// The default longest gap between two samples, in seconds, that is considered part of
+// continuous recording. Longer gaps are treated as pauses.
+const defaultMaxGap = 10
+
+var (
+	ErrNilStreamSet  = errors.New("stream set is nil")
+	ErrMissingStream = errors.New("missing stream")
+	ErrNoSamples     = errors.New("stream has no samples")
+	ErrInvalidOpts   = errors.New("invalid options")
+	ErrNilSegment    = errors.New("segment is nil")
+)
+
+func missingStream(name string) error {
+	return fmt.Errorf("%w: %s", ErrMissingStream, name)
+}
+
+// Returns the elapsed time, in seconds, of the first n samples of the set. When the set has
+// no TimeStream samples are assumed to have been recorded once per second.
+func sampleTimes(set *gostrava.StreamSet, n int) []int {
+	t := make([]int, n)
+	for i := range t {
+		if set.TimeStream != nil && i < len(set.TimeStream.Data) {
+			t[i] = set.TimeStream.Data[i]
+		} else if i > 0 {
+			t[i] = t[i-1] + 1
+		}
+	}
+	return t
+}
+
+// Returns the number of samples that can be analysed together with the TimeStream, if any.
+func sampleCount(set *gostrava.StreamSet, n int) int {
+	if set.TimeStream != nil && len(set.TimeStream.Data) < n {
+		return len(set.TimeStream.Data)
+	}
+	return n
+}
+
+// Returns whether the athlete was moving at each of the first n samples, according to
+// MovingStream. Samples without moving information are considered moving.
+func movingMask(set *gostrava.StreamSet, n int) []bool {
+	mask := make([]bool, n)
+	for i := range mask {
+		mask[i] = set.MovingStream == nil || i >= len(set.MovingStream.Data) || set.MovingStream.Data[i]
+	}
+	return mask
+}
+
+// A sampled signal spread over one value per recorded second.
+type secondly struct {
+	values []float64
+	index  []int // The stream sample each second was taken from
+}
+
+// Spreads values over one value per second. Each sample covers the time elapsed since the
+// previous one; samples excluded by include cover no time at all. Gaps longer than maxGap
+// are filled with zeros when fillGaps is set, otherwise they are collapsed to the sample
+// itself so that pauses do not count towards the result.
+func perSecond(t []int, values []float64, include []bool, maxGap int, fillGaps bool) secondly {
+	s := secondly{
+		values: make([]float64, 0, len(values)),
+		index:  make([]int, 0, len(values)),
+	}
+
+	for i, v := range values {
+		if include != nil && !include[i] {
+			continue
+		}
+
+		dt := 1
+		if i > 0 {
+			dt = t[i] - t[i-1]
+		}
+		if dt < 1 {
+			continue
+		}
+
+		if dt > maxGap {
+			if fillGaps {
+				for j := 1; j < dt; j++ {
+					s.values = append(s.values, 0)
+					s.index = append(s.index, i)
+				}
+			}
+			dt = 1
+		}
+
+		for j := 0; j < dt; j++ {
+			s.values = append(s.values, v)
+			s.index = append(s.index, i)
+		}
+	}
+
+	return s
+}
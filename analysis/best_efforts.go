@@ -0,0 +1,90 @@
+package analysis
+
+import (
+	"github.com/guisaez/gostrava"
+)
+
+type EffortDistance struct {
+	Name     string  // The name of the effort, as used by Strava for best efforts
+	Distance float64 // The distance of the effort, in meters
+}
+
+// Standard distances searched by FindBestEfforts when none are given.
+var StandardDistances = []EffortDistance{
+	{Name: "400m", Distance: 400},
+	{Name: "1k", Distance: 1000},
+	{Name: "1 mile", Distance: 1609.344},
+	{Name: "5k", Distance: 5000},
+	{Name: "10k", Distance: 10000},
+	{Name: "Half-Marathon", Distance: 21097.5},
+	{Name: "Marathon", Distance: 42195},
+}
+
+type BestEffort struct {
+	gostrava.SegmentEffortSummary
+	Name       string // The name of the effort distance
+	StartIndex int    // The start index of this effort in its activity's stream
+	EndIndex   int    // The end index of this effort in its activity's stream
+	MovingTime int    // The effort's moving time, in seconds
+}
+
+// Finds the fastest effort over each of the given distances by scanning the DistanceStream and
+// TimeStream of the set. It defaults to StandardDistances. Distances longer than the activity are
+// skipped. Efforts are identified by stream indices only; the ID, ActivityID and start dates of the
+// embedded SegmentEffortSummary are left for the caller to fill.
+func FindBestEfforts(set *gostrava.StreamSet, distances ...EffortDistance) ([]BestEffort, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.DistanceStream == nil {
+		return nil, missingStream("distance")
+	}
+	if len(distances) == 0 {
+		distances = StandardDistances
+	}
+
+	n := sampleCount(set, len(set.DistanceStream.Data))
+	if n == 0 {
+		return nil, ErrNoSamples
+	}
+
+	t := sampleTimes(set, n)
+	moving := movingMask(set, n)
+	dist := make([]float64, n)
+	for i := range dist {
+		dist[i] = float64(set.DistanceStream.Data[i])
+	}
+
+	efforts := []BestEffort{}
+	for _, d := range distances {
+		start, end, ok := fastestSpan(dist, t, d.Distance)
+		if !ok {
+			continue
+		}
+
+		effort := BestEffort{
+			Name:       d.Name,
+			StartIndex: start,
+			EndIndex:   end,
+			MovingTime: movingTime(t, moving, start, end),
+		}
+		effort.Distance = float32(d.Distance)
+		effort.ElapsedTime = t[end] - t[start]
+
+		efforts = append(efforts, effort)
+	}
+
+	return efforts, nil
+}
+
+// Returns the time, in seconds, spent moving between the start and end samples. Each sample
+// accounts for the time elapsed since the previous one.
+func movingTime(t []int, moving []bool, start, end int) int {
+	total := 0
+	for i := start + 1; i <= end; i++ {
+		if moving[i] {
+			total += t[i] - t[i-1]
+		}
+	}
+	return total
+}
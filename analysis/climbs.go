@@ -0,0 +1,87 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/guisaez/gostrava"
+)
+
+// Shortest distance, in meters, over which the maximum grade of a climb is measured.
+const maxGradeWindow = 100
+
+type ClimbSegment struct {
+	gostrava.SegmentSummary
+	StartIndex    int     // The index of the bottom of the climb in the stream
+	EndIndex      int     // The index of the top of the climb in the stream
+	ElevationGain float64 // The difference in elevation between the top and the bottom, in meters
+	Score         float64 // The Strava-style score of the climb, its distance times its average grade
+}
+
+// Detects the significant climbs of an activity or a route from its AltitudeStream and DistanceStream,
+// scoring and categorizing each one. Start and end coordinates are filled from the LatLngStream when
+// available. For routes, build the set from StreamsService.GetRouteStreams with gostrava.NewStreamSet.
+func DetectClimbs(set *gostrava.StreamSet, opts ElevationOpts) ([]ClimbSegment, error) {
+	summary, err := Elevation(set, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	dist := sampleDistances(set)
+	alt := summary.Altitude
+
+	climbs := make([]ClimbSegment, 0, len(summary.Climbs))
+	for i, c := range summary.Climbs {
+		climb := ClimbSegment{
+			StartIndex:    c.StartIndex,
+			EndIndex:      c.EndIndex,
+			ElevationGain: c.ElevationGain,
+			Score:         ClimbScore(c.Distance, c.AvgGrade),
+		}
+
+		climb.Name = fmt.Sprintf("Climb %d", i+1)
+		climb.Distance = float32(c.Distance)
+		climb.AvgGrade = float32(c.AvgGrade)
+		climb.MaxGrade = float32(maxGradeBetween(dist, alt, c.StartIndex, c.EndIndex))
+		climb.ClimbCategory = c.ClimbCategory
+
+		climb.ElevationHigh, climb.ElevationLow = float32(alt[c.StartIndex]), float32(alt[c.StartIndex])
+		for _, a := range alt[c.StartIndex : c.EndIndex+1] {
+			climb.ElevationHigh = float32(math.Max(float64(climb.ElevationHigh), a))
+			climb.ElevationLow = float32(math.Min(float64(climb.ElevationLow), a))
+		}
+
+		if s := set.LatLngStream; s != nil && c.EndIndex < len(s.Data) {
+			climb.StartLatLng = s.Data[c.StartIndex]
+			climb.EndLatLng = s.Data[c.EndIndex]
+		}
+
+		climbs = append(climbs, climb)
+	}
+
+	return climbs, nil
+}
+
+// Returns the steepest grade, in percents, over any stretch of at least maxGradeWindow meters between
+// the start and end samples. Climbs shorter than the window return their average grade.
+func maxGradeBetween(dist, alt []float64, start, end int) float64 {
+	if dist[end]-dist[start] <= maxGradeWindow {
+		if d := dist[end] - dist[start]; d > 0 {
+			return (alt[end] - alt[start]) / d * 100
+		}
+		return 0
+	}
+
+	max := math.Inf(-1)
+	lo := start
+	for hi := start + 1; hi <= end; hi++ {
+		for lo+1 < hi && dist[hi]-dist[lo+1] >= maxGradeWindow {
+			lo++
+		}
+		if d := dist[hi] - dist[lo]; d >= maxGradeWindow {
+			max = math.Max(max, (alt[hi]-alt[lo])/d*100)
+		}
+	}
+
+	return max
+}
@@ -0,0 +1,234 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+
+	"github.com/guisaez/gostrava"
+)
+
+const (
+	defaultCorridorWidth    = 50   // meters
+	defaultCorridorTileSize = 5000 // meters
+	defaultCorridorCoverage = 90   // percent
+)
+
+type CorridorOpts struct {
+	Width    float64                    // Largest distance, in meters, between the route and a segment on it. Defaults to 50
+	TileSize float64                    // The side, in meters, of the tiles explored along the route. Defaults to 5000
+	Coverage float64                    // The smallest percentage of a segment's length that must lie on the route. Defaults to 90
+	Explore  gostrava.ExploreRegionOpts // The activity type, climb categories and rate limit handling of the requests. MaxRequests is the budget of the whole search
+}
+
+type CorridorSegment struct {
+	Segment  *gostrava.ExplorerSegment // The segment
+	Start    float64                   // The distance along the route at which the segment starts, in meters
+	End      float64                   // The distance along the route at which the segment ends, in meters
+	Coverage float64                   // The percentage of the segment's length within the corridor
+}
+
+// Returns the segments a route passes through, ordered by distance along the route. The route geometry
+// comes from its streams when routeSet is set, and from its summary polyline otherwise. See SegmentsAlong.
+func SegmentsAlongRoute(segments *gostrava.SegmentsService, accessToken string, route *gostrava.RouteDetailed, routeSet *gostrava.StreamSet, opts CorridorOpts) ([]CorridorSegment, error) {
+	points, err := routeGeometry(route, routeSet)
+	if err != nil {
+		return nil, err
+	}
+	return SegmentsAlong(segments, accessToken, points, opts)
+}
+
+// Returns the segments a track passes through, ordered by distance along the track. The corridor of
+// opts.Width meters around the track is covered with tiles explored with ExploreTiles, which only
+// splits the quarters that overlap the corridor, and every segment found is checked against the
+// track: it must be followed from its start to its end, in its direction, with at least opts.Coverage
+// percent of its length within the corridor. A segment the track passes through several times, such
+// as on laps, is returned once per pass.
+//
+// When the exploration fails, such as once opts.Explore.MaxRequests is reached, the segments found so
+// far are matched and returned along with the error.
+func SegmentsAlong(segments *gostrava.SegmentsService, accessToken string, points []gostrava.LatLng, opts CorridorOpts) ([]CorridorSegment, error) {
+	if len(points) < 2 {
+		return nil, missingStream("route latlng")
+	}
+	if opts.Width <= 0 {
+		opts.Width = defaultCorridorWidth
+	}
+	if opts.TileSize <= 0 {
+		opts.TileSize = defaultCorridorTileSize
+	}
+	if opts.Coverage <= 0 {
+		opts.Coverage = defaultCorridorCoverage
+	}
+
+	proj := newProjection(points[0])
+	route := newPath(proj.points(points))
+
+	samples := corridorSamples(route, opts.Width)
+	explore := opts.Explore
+	explore.Overlaps = func(b gostrava.Bounds) bool {
+		if opts.Explore.Overlaps != nil && !opts.Explore.Overlaps(b) {
+			return false
+		}
+		return corridorOverlaps(b, samples, proj, opts.Width)
+	}
+	found, exploreErr := segments.ExploreTiles(accessToken, corridorTiles(samples, proj, opts.Width, opts.TileSize), explore)
+
+	matches := []CorridorSegment{}
+	for _, s := range found {
+		geometry := []gostrava.LatLng{s.StartLatLng, s.EndLatLng}
+		if s.Points != "" {
+			decoded, err := gostrava.DecodePolyline(s.Points)
+			if err != nil {
+				return nil, err
+			}
+			geometry = decoded
+		}
+		if len(geometry) < 2 {
+			continue
+		}
+		matches = append(matches, corridorMatches(route, newPath(proj.points(geometry)), s, opts)...)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Start < matches[j].Start })
+	return matches, exploreErr
+}
+
+// Returns points of the route every width meters, from its start to its end. Every point of the route
+// lies within width/2 of one of them.
+func corridorSamples(route path, width float64) []point {
+	samples := []point{}
+	for along := 0.0; ; along += width {
+		along = math.Min(along, route.length())
+		samples = append(samples, route.at(along))
+		if along >= route.length() {
+			return samples
+		}
+	}
+}
+
+// Returns whether the bounds may overlap the corridor of width meters around the route, from its
+// samples. Bounds up to half a width too far may be kept, but none within the corridor is missed.
+func corridorOverlaps(b gostrava.Bounds, samples []point, proj projection, width float64) bool {
+	sw := proj.point(gostrava.LatLng{b.SWLat, b.SWLng})
+	ne := proj.point(gostrava.LatLng{b.NELat, b.NELng})
+	for _, p := range samples {
+		dx := math.Max(0, math.Max(sw.x-p.x, p.x-ne.x))
+		dy := math.Max(0, math.Max(sw.y-p.y, p.y-ne.y))
+		if math.Hypot(dx, dy) <= width*1.5 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the tiles of a grid of roughly tileSize meters that the corridor of the route overlaps, in
+// the order the route reaches them.
+func corridorTiles(samples []point, proj projection, width, tileSize float64) []gostrava.Bounds {
+	latStep := tileSize / earthRadius * 180 / math.Pi
+	lngStep := latStep / proj.cosLat0
+	cell := func(ll gostrava.LatLng) [2]int {
+		return [2]int{int(math.Floor(float64(ll[0]) / latStep)), int(math.Floor(float64(ll[1]) / lngStep))}
+	}
+
+	tiles := []gostrava.Bounds{}
+	seen := map[[2]int]bool{}
+	for _, p := range samples {
+		sw := cell(proj.latLng(point{x: p.x - width, y: p.y - width}))
+		ne := cell(proj.latLng(point{x: p.x + width, y: p.y + width}))
+		for y := sw[0]; y <= ne[0]; y++ {
+			for x := sw[1]; x <= ne[1]; x++ {
+				if seen[[2]int{y, x}] {
+					continue
+				}
+				seen[[2]int{y, x}] = true
+				tiles = append(tiles, gostrava.Bounds{
+					SWLat: float32(float64(y) * latStep),
+					SWLng: float32(float64(x) * lngStep),
+					NELat: float32(float64(y+1) * latStep),
+					NELng: float32(float64(x+1) * lngStep),
+				})
+			}
+		}
+	}
+	return tiles
+}
+
+// A pass of the route near a point: the closest approach of a run of consecutive edges within the corridor.
+type pass struct {
+	along float64
+	edge  int
+}
+
+// Returns the passes of the edges [from, to) of the route within width of q.
+func passes(route path, q point, width float64, from, to int) []pass {
+	result := []pass{}
+	best, inside := math.Inf(1), false
+	for e := max(from, 0); e < min(to, len(route.pts)-1); e++ {
+		d, t := segmentDistance(q, route.pts[e], route.pts[e+1])
+		if d > width {
+			inside = false
+			continue
+		}
+		if !inside {
+			result = append(result, pass{edge: e})
+			best, inside = math.Inf(1), true
+		}
+		if d < best {
+			best = d
+			result[len(result)-1] = pass{along: route.cum[e] + t*(route.cum[e+1]-route.cum[e]), edge: e}
+		}
+	}
+	return result
+}
+
+// Returns the passes of the route through the segment: from a pass near its start to the first pass
+// near its end that follows within a reasonable detour, when enough of the segment lies on that part
+// of the route.
+func corridorMatches(route, seg path, s *gostrava.ExplorerSegment, opts CorridorOpts) []CorridorSegment {
+	start, end := seg.pts[0], seg.pts[len(seg.pts)-1]
+	maxTravel := seg.length()*maxMatchDetour + matchLookahead
+
+	matches := []CorridorSegment{}
+	next := 0
+	for _, p := range passes(route, start, opts.Width, 0, len(route.pts)) {
+		if p.edge < next {
+			continue
+		}
+
+		to := p.edge + 1
+		for to < len(route.pts)-1 && route.cum[to] < p.along+maxTravel {
+			to++
+		}
+		ends := passes(route, end, opts.Width, p.edge, to)
+		if len(ends) == 0 || ends[0].along <= p.along {
+			continue
+		}
+		q := ends[0]
+
+		coverage := corridorCoverage(route, seg, p.edge, q.edge+1, opts.Width)
+		if coverage < opts.Coverage {
+			continue
+		}
+
+		matches = append(matches, CorridorSegment{Segment: s, Start: p.along, End: q.along, Coverage: coverage})
+		next = q.edge + 1
+	}
+	return matches
+}
+
+// Returns the percentage of the segment's length within width of the edges [from, to) of the route.
+func corridorCoverage(route, seg path, from, to int, width float64) float64 {
+	length := seg.length()
+	if length == 0 {
+		return 100
+	}
+
+	covered, total := 0, 0
+	for along := 0.0; along <= length; along += coverageStep {
+		total++
+		if d, _, _ := route.nearest(seg.at(along), from, to); d <= width {
+			covered++
+		}
+	}
+	return float64(covered) / float64(total) * 100
+}
@@ -0,0 +1,347 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/guisaez/gostrava"
+)
+
+// Curves are evaluated exactly on a fixed grid rather than at every duration or distance, which keeps
+// them O(n log n): every step up to the dense limit, then steps growing by curveGrowth. The grid is the
+// same for every activity, truncated at its length, so curves from different activities line up when merged.
+const (
+	curveGrowth          = 1.02
+	denseDurationLimit   = 60   // seconds
+	denseDistanceLimit   = 1000 // meters
+	denseDistanceStep    = 100  // meters
+	minPaceCurveDistance = 100  // meters
+)
+
+type PowerCurve struct {
+	ActivityID int       // The activity the curve was computed from, zero for merged curves
+	StartDate  time.Time // The time at which the activity was started, zero for merged curves
+	Points     []PowerCurvePoint
+}
+
+type PowerCurvePoint struct {
+	Duration   int     // The duration of the effort, in seconds
+	Watts      float64 // The best average power held for Duration, in watts
+	StartIndex int     // The start index of the effort in its activity's stream
+	ActivityID int     // The activity the effort belongs to
+	StartDate  time.Time
+}
+
+type PaceCurve struct {
+	ActivityID int       // The activity the curve was computed from, zero for merged curves
+	StartDate  time.Time // The time at which the activity was started, zero for merged curves
+	Points     []PaceCurvePoint
+}
+
+type PaceCurvePoint struct {
+	Distance   float64 // The distance of the effort, in meters
+	Time       float64 // The fastest time over Distance, in seconds
+	StartIndex int     // The start index of the effort in its activity's stream
+	EndIndex   int     // The end index of the effort in its activity's stream
+	ActivityID int     // The activity the effort belongs to
+	StartDate  time.Time
+}
+
+// Returns the pace of the effort, in seconds per kilometer.
+func (p PaceCurvePoint) Pace() float64 {
+	return p.Time / p.Distance * 1000
+}
+
+// Computes the mean-maximal power curve of the set: the best average power held for every duration
+// of the grid from 1 second to the full activity. Pauses count as zero watts. The curve's ActivityID
+// and StartDate are left for the caller to fill.
+func MeanMaxPower(set *gostrava.StreamSet) (*PowerCurve, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.WattsStream == nil {
+		return nil, missingStream("watts")
+	}
+
+	n := sampleCount(set, len(set.WattsStream.Data))
+	if n == 0 {
+		return nil, ErrNoSamples
+	}
+
+	watts := make([]float64, n)
+	for i := range watts {
+		if w := set.WattsStream.Data[i]; w > 0 {
+			watts[i] = float64(w)
+		}
+	}
+
+	s := perSecond(sampleTimes(set, n), watts, nil, defaultMaxGap, true)
+
+	// prefix[i] holds the sum of the first i seconds
+	prefix := make([]float64, len(s.values)+1)
+	for i, w := range s.values {
+		prefix[i+1] = prefix[i] + w
+	}
+
+	curve := &PowerCurve{}
+	for _, d := range durationGrid(len(s.values)) {
+		best, start := -1.0, 0
+		for i := 0; i+d <= len(s.values); i++ {
+			if sum := prefix[i+d] - prefix[i]; sum > best {
+				best, start = sum, i
+			}
+		}
+
+		curve.Points = append(curve.Points, PowerCurvePoint{
+			Duration:   d,
+			Watts:      best / float64(d),
+			StartIndex: s.index[start],
+		})
+	}
+
+	return curve, nil
+}
+
+// Computes the best-pace-for-distance curve of the set from its DistanceStream and TimeStream:
+// the fastest time over every distance of the grid from 100 meters to the full activity. The
+// curve's ActivityID and StartDate are left for the caller to fill.
+func BestPace(set *gostrava.StreamSet) (*PaceCurve, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.DistanceStream == nil {
+		return nil, missingStream("distance")
+	}
+
+	n := sampleCount(set, len(set.DistanceStream.Data))
+	if n == 0 {
+		return nil, ErrNoSamples
+	}
+
+	t := sampleTimes(set, n)
+	dist := make([]float64, n)
+	for i := range dist {
+		dist[i] = float64(set.DistanceStream.Data[i])
+	}
+
+	curve := &PaceCurve{}
+	for _, d := range distanceGrid(dist[n-1] - dist[0]) {
+		start, end, ok := fastestSpan(dist, t, d)
+		if !ok {
+			continue
+		}
+
+		// Scale the time down to the exact distance, spans overshoot it by up to one sample
+		elapsed := float64(t[end]-t[start]) * d / (dist[end] - dist[start])
+
+		curve.Points = append(curve.Points, PaceCurvePoint{
+			Distance:   d,
+			Time:       elapsed,
+			StartIndex: start,
+			EndIndex:   end,
+		})
+	}
+
+	return curve, nil
+}
+
+// Returns the start and end sample of the fastest span covering at least d meters, using two
+// pointers over the cumulative distance in O(n).
+func fastestSpan(dist []float64, t []int, d float64) (start, end int, ok bool) {
+	best := math.MaxInt
+	i := 0
+	for j := range dist {
+		for i < j && dist[j]-dist[i+1] >= d {
+			i++
+		}
+		if i < j && dist[j]-dist[i] >= d && t[j]-t[i] < best {
+			best, start, end, ok = t[j]-t[i], i, j, true
+		}
+	}
+	return start, end, ok
+}
+
+// Returns the durations, in seconds, at which power curves are evaluated for a series of n seconds.
+func durationGrid(n int) []int {
+	var grid []int
+	for d := 1; d < n; {
+		grid = append(grid, d)
+		if d < denseDurationLimit {
+			d++
+		} else {
+			d = int(math.Max(float64(d+1), math.Round(float64(d)*curveGrowth)))
+		}
+	}
+	if n > 0 {
+		grid = append(grid, n)
+	}
+	return grid
+}
+
+// Returns the distances, in meters, at which pace curves are evaluated for an activity of the given length.
+func distanceGrid(total float64) []float64 {
+	var grid []float64
+	for d := float64(minPaceCurveDistance); d < total; {
+		grid = append(grid, d)
+		if d < denseDistanceLimit {
+			d += denseDistanceStep
+		} else {
+			d = math.Round(d * curveGrowth)
+		}
+	}
+	if total >= minPaceCurveDistance {
+		grid = append(grid, total)
+	}
+	return grid
+}
+
+// Returns the average power at the given duration, interpolating linearly between grid points.
+// Durations beyond the end of the curve return zero.
+func (c *PowerCurve) At(duration int) float64 {
+	i := sort.Search(len(c.Points), func(i int) bool { return c.Points[i].Duration >= duration })
+	if i == len(c.Points) {
+		return 0
+	}
+	if c.Points[i].Duration == duration || i == 0 {
+		return c.Points[i].Watts
+	}
+
+	a, b := c.Points[i-1], c.Points[i]
+	f := float64(duration-a.Duration) / float64(b.Duration-a.Duration)
+	return a.Watts + (b.Watts-a.Watts)*f
+}
+
+// Returns the fastest time at the given distance, interpolating linearly between grid points.
+// Distances beyond the end of the curve return zero.
+func (c *PaceCurve) At(distance float64) float64 {
+	i := sort.Search(len(c.Points), func(i int) bool { return c.Points[i].Distance >= distance })
+	if i == len(c.Points) {
+		return 0
+	}
+	if c.Points[i].Distance == distance || i == 0 {
+		return c.Points[i].Time * distance / c.Points[i].Distance
+	}
+
+	a, b := c.Points[i-1], c.Points[i]
+	f := (distance - a.Distance) / (b.Distance - a.Distance)
+	return a.Time + (b.Time-a.Time)*f
+}
+
+// Merges power curves into their envelope, keeping the best power at every duration along with the
+// activity it came from. Only curves whose StartDate falls within [from, to) are considered; a zero
+// from or to leaves that end of the range open. Points off the shared grid, the full duration of each
+// activity, are only kept for the longest activities, as the others have no point there to compare
+// them with. The envelope never increases with duration: where a longer effort has more power than a
+// shorter one, it is also the best effort for the shorter duration and replaces it.
+func MergePowerCurves(curves []*PowerCurve, from, to time.Time) *PowerCurve {
+	longest := 0
+	for _, c := range curves {
+		if c != nil && inRange(c.StartDate, from, to) && len(c.Points) > 0 {
+			longest = max(longest, c.Points[len(c.Points)-1].Duration)
+		}
+	}
+	grid := map[int]bool{longest: true}
+	for _, d := range durationGrid(longest + 1) {
+		grid[d] = true
+	}
+
+	best := map[int]PowerCurvePoint{}
+	for _, c := range curves {
+		if c == nil || !inRange(c.StartDate, from, to) {
+			continue
+		}
+		for _, p := range c.Points {
+			if !grid[p.Duration] {
+				continue
+			}
+			if p.ActivityID == 0 {
+				p.ActivityID, p.StartDate = c.ActivityID, c.StartDate
+			}
+			if b, ok := best[p.Duration]; !ok || p.Watts > b.Watts {
+				best[p.Duration] = p
+			}
+		}
+	}
+
+	envelope := &PowerCurve{Points: make([]PowerCurvePoint, 0, len(best))}
+	for _, p := range best {
+		envelope.Points = append(envelope.Points, p)
+	}
+	sort.Slice(envelope.Points, func(i, j int) bool {
+		return envelope.Points[i].Duration < envelope.Points[j].Duration
+	})
+
+	for i := len(envelope.Points) - 2; i >= 0; i-- {
+		if p, next := envelope.Points[i], envelope.Points[i+1]; p.Watts < next.Watts {
+			next.Duration = p.Duration
+			envelope.Points[i] = next
+		}
+	}
+
+	return envelope
+}
+
+// Merges pace curves into their envelope, keeping the fastest time at every distance along with the
+// activity it came from. Only curves whose StartDate falls within [from, to) are considered; a zero
+// from or to leaves that end of the range open. Points off the shared grid, the full distance of each
+// activity, are only kept for the longest activities, as the others have no point there to compare
+// them with. The envelope never decreases with distance: where a longer effort is faster than a
+// shorter one, it is also the best effort for the shorter distance and replaces it.
+func MergePaceCurves(curves []*PaceCurve, from, to time.Time) *PaceCurve {
+	longest := 0.0
+	for _, c := range curves {
+		if c != nil && inRange(c.StartDate, from, to) && len(c.Points) > 0 {
+			longest = math.Max(longest, c.Points[len(c.Points)-1].Distance)
+		}
+	}
+	grid := map[float64]bool{longest: true}
+	for _, d := range distanceGrid(longest + 1) {
+		grid[d] = true
+	}
+
+	best := map[float64]PaceCurvePoint{}
+	for _, c := range curves {
+		if c == nil || !inRange(c.StartDate, from, to) {
+			continue
+		}
+		for _, p := range c.Points {
+			if !grid[p.Distance] {
+				continue
+			}
+			if p.ActivityID == 0 {
+				p.ActivityID, p.StartDate = c.ActivityID, c.StartDate
+			}
+			if b, ok := best[p.Distance]; !ok || p.Time < b.Time {
+				best[p.Distance] = p
+			}
+		}
+	}
+
+	envelope := &PaceCurve{Points: make([]PaceCurvePoint, 0, len(best))}
+	for _, p := range best {
+		envelope.Points = append(envelope.Points, p)
+	}
+	sort.Slice(envelope.Points, func(i, j int) bool {
+		return envelope.Points[i].Distance < envelope.Points[j].Distance
+	})
+
+	for i := len(envelope.Points) - 2; i >= 0; i-- {
+		if p, next := envelope.Points[i], envelope.Points[i+1]; p.Time > next.Time {
+			next.Distance = p.Distance
+			envelope.Points[i] = next
+		}
+	}
+
+	return envelope
+}
+
+func inRange(t, from, to time.Time) bool {
+	if !from.IsZero() && t.Before(from) {
+		return false
+	}
+	if !to.IsZero() && !t.Before(to) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/guisaez/gostrava"
+)
+
+const (
+	defaultHistoryPerPage = 200                  // The largest page size accepted by Strava
+	defaultHistoryWindow  = 365 * 24 * time.Hour // The span of the date windows efforts are listed over
+	defaultRollingWindow  = 90 * 24 * time.Hour
+	prRanks               = 3 // The number of efforts on an athlete's segment leaderboard
+)
+
+// The first day efforts can have been recorded on, used when no start date is given.
+var stravaEpoch = time.Date(2009, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+type CollectEffortsOpts struct {
+	From    time.Time     // The local date of the earliest efforts. Defaults to 2009, when Strava started
+	Until   time.Time     // The local date of the latest efforts. Defaults to now
+	Window  time.Duration // The span of each date window listed. Defaults to a year
+	PerPage int           // Number of efforts per page. Defaults to 200
+}
+
+// Returns all of the authenticated athlete's efforts on a segment, oldest first. The dates are split
+// into windows, each listed page by page until a page comes back short, and efforts returned by more
+// than one window are kept once.
+func CollectSegmentEfforts(efforts *gostrava.SegmentEffortsService, accessToken string, segmentID int, opts CollectEffortsOpts) ([]gostrava.SegmentEffortDetailed, error) {
+	if opts.From.IsZero() {
+		opts.From = stravaEpoch
+	}
+	if opts.Until.IsZero() {
+		opts.Until = time.Now()
+	}
+	if opts.Window <= 0 {
+		opts.Window = defaultHistoryWindow
+	}
+	if opts.PerPage <= 0 {
+		opts.PerPage = defaultHistoryPerPage
+	}
+	if opts.Until.Before(opts.From) {
+		return nil, ErrInvalidOpts
+	}
+
+	collected := []gostrava.SegmentEffortDetailed{}
+	seen := map[int]bool{}
+	for start := opts.From; !start.After(opts.Until); start = start.Add(opts.Window) {
+		end := start.Add(opts.Window)
+		if end.After(opts.Until) {
+			end = opts.Until
+		}
+
+		for page := 1; ; page++ {
+			list, err := efforts.ListSegmentEfforts(accessToken, segmentID, gostrava.ListSegmentEffortOptions{
+				Page:           page,
+				PerPage:        opts.PerPage,
+				StartDateLocal: start,
+				EndDateLocal:   end,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			for _, e := range list {
+				if !seen[e.ID] {
+					seen[e.ID] = true
+					collected = append(collected, e)
+				}
+			}
+			if len(list) < opts.PerPage {
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(collected, func(i, j int) bool {
+		return effortDate(&collected[i]).Before(effortDate(&collected[j]))
+	})
+	return collected, nil
+}
+
+type EffortHistoryOpts struct {
+	RollingWindow time.Duration                    // The span over which RollingBest is taken. Defaults to 90 days
+	PR            *gostrava.SummaryPRSegmentEffort // The PR reported by Strava, usually SegmentSummary.AthletePREffort, to compare efforts to
+}
+
+// An effort in the history, with the figures to chart it against the others.
+type EffortPoint struct {
+	ID          int       // The unique identifier of the effort
+	ActivityID  int       // The unique identifier of the activity of the effort
+	Date        time.Time // The time at which the effort was started
+	ElapsedTime int       // The effort's elapsed time, in seconds
+	Speed       float64   // The effort's average speed, in meters per second
+	Best        int       // The best elapsed time up to this effort, in seconds
+	RollingBest int       // The best elapsed time over the rolling window ending at this effort, in seconds
+	PR          bool      // Whether the effort was a PR when it was recorded
+	PRRank      int       // The rank the effort had on the athlete's top 3 when it was recorded, 0 when outside it
+	BeatsPR     bool      // Whether the effort is at least as fast as the reference PR
+	PRGap       int       // The difference with the reference PR's elapsed time, in seconds, negative when faster
+}
+
+type EffortHistory struct {
+	Efforts     []EffortPoint // Every effort, oldest first
+	Progression []EffortPoint // The efforts that were PRs when recorded, oldest first
+	Count       int           // The number of efforts
+	Best        int           // The best elapsed time, in seconds
+	Worst       int           // The worst elapsed time, in seconds
+	Median      float64       // The median elapsed time, in seconds
+	Mean        float64       // The mean elapsed time, in seconds
+	StdDev      float64       // The standard deviation of elapsed times, in seconds
+	Consistency float64       // The coefficient of variation of elapsed times, in percents. Lower is more consistent
+}
+
+// Computes the PR progression, rolling best and consistency of the efforts on a segment, such as
+// those returned by CollectSegmentEfforts or MatchSegment. Efforts are ranked by elapsed time, as on
+// Strava leaderboards, and those without one are skipped. When opts.PR is set each effort is also
+// compared to it, which tells which efforts matched locally would have ranked against Strava's PR.
+func AnalyzeEffortHistory(efforts []gostrava.SegmentEffortDetailed, opts EffortHistoryOpts) (*EffortHistory, error) {
+	if opts.RollingWindow <= 0 {
+		opts.RollingWindow = defaultRollingWindow
+	}
+
+	sorted := make([]*gostrava.SegmentEffortDetailed, 0, len(efforts))
+	for i := range efforts {
+		if efforts[i].ElapsedTime > 0 {
+			sorted = append(sorted, &efforts[i])
+		}
+	}
+	if len(sorted) == 0 {
+		return nil, ErrNoSamples
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return effortDate(sorted[i]).Before(effortDate(sorted[j])) })
+
+	h := &EffortHistory{Count: len(sorted), Best: sorted[0].ElapsedTime, Worst: sorted[0].ElapsedTime}
+	times := make([]int, 0, len(sorted)) // The elapsed times so far, fastest first
+	window := 0                          // The index of the oldest effort within the rolling window
+	for i, e := range sorted {
+		p := EffortPoint{
+			ID:          e.ID,
+			ActivityID:  e.ActivityID,
+			Date:        effortDate(e),
+			ElapsedTime: e.ElapsedTime,
+		}
+		if e.Distance > 0 {
+			p.Speed = float64(e.Distance) / float64(e.ElapsedTime)
+		}
+
+		rank := sort.SearchInts(times, e.ElapsedTime) + 1
+		if rank <= prRanks {
+			p.PRRank = rank
+		}
+		p.PR = len(times) == 0 || e.ElapsedTime < times[0]
+		times = append(times, 0)
+		copy(times[rank:], times[rank-1:])
+		times[rank-1] = e.ElapsedTime
+		p.Best = times[0]
+
+		for p.Date.Sub(effortDate(sorted[window])) >= opts.RollingWindow {
+			window++
+		}
+		p.RollingBest = e.ElapsedTime
+		for _, w := range sorted[window:i] {
+			p.RollingBest = min(p.RollingBest, w.ElapsedTime)
+		}
+
+		if opts.PR != nil && opts.PR.PRElapsedTime > 0 {
+			p.PRGap = e.ElapsedTime - opts.PR.PRElapsedTime
+			p.BeatsPR = p.PRGap <= 0
+		}
+
+		h.Efforts = append(h.Efforts, p)
+		if p.PR {
+			h.Progression = append(h.Progression, p)
+		}
+		h.Best = min(h.Best, e.ElapsedTime)
+		h.Worst = max(h.Worst, e.ElapsedTime)
+		h.Mean += float64(e.ElapsedTime)
+	}
+
+	h.Mean /= float64(h.Count)
+	for _, t := range times {
+		h.StdDev += (float64(t) - h.Mean) * (float64(t) - h.Mean)
+	}
+	h.StdDev = math.Sqrt(h.StdDev / float64(h.Count))
+	h.Consistency = h.StdDev / h.Mean * 100
+
+	if mid := h.Count / 2; h.Count%2 == 1 {
+		h.Median = float64(times[mid])
+	} else {
+		h.Median = float64(times[mid-1]+times[mid]) / 2
+	}
+
+	return h, nil
+}
+
+// Returns the start time of an effort, falling back to its local start time.
+func effortDate(e *gostrava.SegmentEffortDetailed) time.Time {
+	if !e.StartDate.Time.IsZero() {
+		return e.StartDate.Time
+	}
+	return e.StartDateLocal.Time
+}
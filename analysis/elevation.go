@@ -0,0 +1,331 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+
+	"github.com/guisaez/gostrava"
+)
+
+type Smoothing int
+
+const (
+	AutoSmoothing   Smoothing = iota // Picks the smoothing of the detected ElevationSource
+	NoSmoothing                      // Uses the altitude as recorded
+	MovingAverage                    // Centered moving average over ElevationOpts.Window meters
+	KalmanSmoothing                  // Kalman filter followed by a backward smoothing pass
+)
+
+type ElevationSource int
+
+const (
+	UnknownElevation    ElevationSource = iota
+	BarometricElevation                 // Altitude from a barometric altimeter, smooth with fine resolution
+	GPSElevation                        // Altitude from GPS, noisy
+)
+
+// Median absolute second difference of the altitude, in meters, above which it is considered GPS altitude.
+const gpsNoiseLevel = 0.5
+
+// Score thresholds of the climb categories, from category 4 (1) to Hors catégorie (5).
+var climbCategoryScores = []float64{8000, 16000, 32000, 64000, 80000}
+
+// Minimum average grade, in percents, of a categorized climb.
+const minCategorizedGrade = 3
+
+// The smoothing parameters used when ElevationOpts leaves them at zero.
+const (
+	defaultElevationWindow  = 30   // meters
+	defaultProcessNoise     = 0.01 // square meters per meter
+	defaultMeasurementNoise = 16   // square meters
+)
+
+type ElevationOpts struct {
+	Smoothing        Smoothing // The smoothing applied to the altitude before computing gain and loss
+	Window           float64   // Length of the moving average window, in meters. Defaults to 30
+	ProcessNoise     float64   // Variance of the altitude change per meter travelled, for KalmanSmoothing. Defaults to 0.01
+	MeasurementNoise float64   // Variance of the altitude measurements, in square meters, for KalmanSmoothing. Defaults to 16
+	Threshold        float64   // Hysteresis, in meters: changes smaller than this do not count towards gain or loss
+	MinClimbGain     float64   // Minimum elevation gain of a climb, in meters. Defaults to 20
+	MinClimbGrade    float64   // Minimum average grade of a climb, in percents. Defaults to 3
+	MaxClimbDip      float64   // Largest descent, in meters, allowed within a climb. Defaults to 10
+}
+
+// Returns the options suited to altitude recorded by the given source.
+func ElevationOptsFor(source ElevationSource) ElevationOpts {
+	if source == GPSElevation {
+		return ElevationOpts{
+			Smoothing:        KalmanSmoothing,
+			ProcessNoise:     defaultProcessNoise,
+			MeasurementNoise: defaultMeasurementNoise,
+			Threshold:        5,
+		}
+	}
+
+	return ElevationOpts{
+		Smoothing: MovingAverage,
+		Window:    defaultElevationWindow,
+		Threshold: 1,
+	}
+}
+
+type ElevationSummary struct {
+	Source        ElevationSource // The detected source of the altitude
+	Gain          float64         // The total elevation gain, in meters
+	Loss          float64         // The total elevation loss, in meters
+	ElevationHigh float64         // The highest elevation, in meters
+	ElevationLow  float64         // The lowest elevation, in meters
+	Climbs        []Climb         // The climbs found along the way
+	Altitude      []float64       // The smoothed altitude of every sample, in meters
+}
+
+type Climb struct {
+	StartIndex    int     // The index of the bottom of the climb in the activity's stream
+	EndIndex      int     // The index of the top of the climb in the activity's stream
+	Distance      float64 // The length of the climb, in meters
+	ElevationGain float64 // The difference in elevation between the top and the bottom, in meters
+	AvgGrade      float64 // The average grade, in percents
+	ClimbCategory int8    // The category of the climb [0, 5], on the same scale as SegmentSummary.ClimbCategory
+}
+
+// Computes elevation gain and loss, the highest and lowest elevations and the climbs of the set from
+// its AltitudeStream and DistanceStream, so that they are consistent across devices. With
+// AutoSmoothing the source of the altitude is detected from its noise and the matching
+// ElevationOptsFor are used, with any other non-zero option applied on top.
+func Elevation(set *gostrava.StreamSet, opts ElevationOpts) (*ElevationSummary, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.AltitudeStream == nil {
+		return nil, missingStream("altitude")
+	}
+
+	dist := sampleDistances(set)
+	if dist == nil {
+		return nil, missingStream("distance")
+	}
+
+	n := len(set.AltitudeStream.Data)
+	if len(dist) < n {
+		n = len(dist)
+	}
+	if n == 0 {
+		return nil, ErrNoSamples
+	}
+
+	alt := make([]float64, n)
+	for i := range alt {
+		alt[i] = float64(set.AltitudeStream.Data[i])
+	}
+	dist = dist[:n]
+
+	summary := &ElevationSummary{Source: detectElevationSource(alt)}
+	if opts.Smoothing == AutoSmoothing {
+		opts = mergeElevationOpts(ElevationOptsFor(summary.Source), opts)
+	}
+	if opts.Window <= 0 {
+		opts.Window = defaultElevationWindow
+	}
+	if opts.ProcessNoise <= 0 {
+		opts.ProcessNoise = defaultProcessNoise
+	}
+	if opts.MeasurementNoise <= 0 {
+		opts.MeasurementNoise = defaultMeasurementNoise
+	}
+
+	switch opts.Smoothing {
+	case MovingAverage:
+		alt = distanceAverage(dist, alt, opts.Window)
+	case KalmanSmoothing:
+		alt = kalmanSmooth(dist, alt, opts.ProcessNoise, opts.MeasurementNoise)
+	}
+	summary.Altitude = alt
+
+	summary.Gain, summary.Loss = hysteresis(alt, opts.Threshold)
+
+	summary.ElevationHigh, summary.ElevationLow = alt[0], alt[0]
+	for _, a := range alt {
+		summary.ElevationHigh = math.Max(summary.ElevationHigh, a)
+		summary.ElevationLow = math.Min(summary.ElevationLow, a)
+	}
+
+	summary.Climbs = findClimbs(dist, alt, opts)
+
+	return summary, nil
+}
+
+// Guesses the source of the altitude from its noise: barometric altimeters produce smooth profiles,
+// while GPS altitude jumps around from sample to sample.
+func detectElevationSource(alt []float64) ElevationSource {
+	if len(alt) < 3 {
+		return UnknownElevation
+	}
+
+	noise := make([]float64, 0, len(alt)-2)
+	for i := 1; i < len(alt)-1; i++ {
+		noise = append(noise, math.Abs(alt[i+1]-2*alt[i]+alt[i-1]))
+	}
+	sort.Float64s(noise)
+
+	if noise[len(noise)/2] > gpsNoiseLevel {
+		return GPSElevation
+	}
+	return BarometricElevation
+}
+
+// Returns the preset with every non-zero option of opts applied on top.
+func mergeElevationOpts(preset, opts ElevationOpts) ElevationOpts {
+	if opts.Window > 0 {
+		preset.Window = opts.Window
+	}
+	if opts.ProcessNoise > 0 {
+		preset.ProcessNoise = opts.ProcessNoise
+	}
+	if opts.MeasurementNoise > 0 {
+		preset.MeasurementNoise = opts.MeasurementNoise
+	}
+	if opts.Threshold > 0 {
+		preset.Threshold = opts.Threshold
+	}
+	preset.MinClimbGain = opts.MinClimbGain
+	preset.MinClimbGrade = opts.MinClimbGrade
+	preset.MaxClimbDip = opts.MaxClimbDip
+	return preset
+}
+
+// Returns the average of the values within a window of the given number of meters centered on each sample.
+func distanceAverage(dist, values []float64, window float64) []float64 {
+	avg := make([]float64, len(values))
+
+	var sum float64
+	lo, hi := 0, -1
+	for i := range values {
+		for hi+1 < len(values) && dist[hi+1]-dist[i] <= window/2 {
+			hi++
+			sum += values[hi]
+		}
+		for dist[i]-dist[lo] > window/2 {
+			sum -= values[lo]
+			lo++
+		}
+		avg[i] = sum / float64(hi-lo+1)
+	}
+
+	return avg
+}
+
+// Smooths the altitude with a Kalman filter modelling it as a random walk along the distance, followed
+// by a Rauch-Tung-Striebel backward pass so the result does not lag behind the profile.
+func kalmanSmooth(dist, alt []float64, processNoise, measurementNoise float64) []float64 {
+	n := len(alt)
+	x := make([]float64, n)     // Filtered estimates
+	p := make([]float64, n)     // Filtered variances
+	pPred := make([]float64, n) // Predicted variances
+
+	x[0], p[0], pPred[0] = alt[0], measurementNoise, measurementNoise
+	for i := 1; i < n; i++ {
+		pPred[i] = p[i-1] + processNoise*math.Max(dist[i]-dist[i-1], 0)
+		k := pPred[i] / (pPred[i] + measurementNoise)
+		x[i] = x[i-1] + k*(alt[i]-x[i-1])
+		p[i] = (1 - k) * pPred[i]
+	}
+
+	for i := n - 2; i >= 0; i-- {
+		if pPred[i+1] > 0 {
+			x[i] += p[i] / pPred[i+1] * (x[i+1] - x[i])
+		}
+	}
+
+	return x
+}
+
+// Accumulates gain and loss, ignoring changes smaller than threshold meters.
+func hysteresis(alt []float64, threshold float64) (gain, loss float64) {
+	ref := alt[0]
+	for _, a := range alt[1:] {
+		if a-ref >= threshold {
+			gain += a - ref
+			ref = a
+		} else if ref-a >= threshold {
+			loss += ref - a
+			ref = a
+		}
+	}
+	return gain, loss
+}
+
+// Finds the climbs of a smoothed profile: rises from a low point to a high point that are not
+// interrupted by a descent longer than MaxClimbDip meters.
+func findClimbs(dist, alt []float64, opts ElevationOpts) []Climb {
+	if opts.MinClimbGain <= 0 {
+		opts.MinClimbGain = 20
+	}
+	if opts.MinClimbGrade <= 0 {
+		opts.MinClimbGrade = minCategorizedGrade
+	}
+	if opts.MaxClimbDip <= 0 {
+		opts.MaxClimbDip = 10
+	}
+
+	climbs := []Climb{}
+	emit := func(lo, hi int) {
+		d := dist[hi] - dist[lo]
+		gain := alt[hi] - alt[lo]
+		if d <= 0 || gain < opts.MinClimbGain {
+			return
+		}
+
+		grade := gain / d * 100
+		if grade < opts.MinClimbGrade {
+			return
+		}
+
+		climbs = append(climbs, Climb{
+			StartIndex:    lo,
+			EndIndex:      hi,
+			Distance:      d,
+			ElevationGain: gain,
+			AvgGrade:      grade,
+			ClimbCategory: ClimbCategory(d, grade),
+		})
+	}
+
+	lo, hi := 0, 0
+	for i := 1; i < len(alt); i++ {
+		switch {
+		case alt[i] > alt[hi]:
+			hi = i
+		case hi == lo && alt[i] <= alt[lo]:
+			// Still at the bottom, the climb starts from the last low point
+			lo, hi = i, i
+		case alt[i] < alt[lo] || alt[hi]-alt[i] > opts.MaxClimbDip:
+			emit(lo, hi)
+			lo, hi = i, i
+		}
+	}
+	emit(lo, hi)
+
+	return climbs
+}
+
+// Returns the Strava-style score of a climb, its distance in meters times its average grade in percents.
+func ClimbScore(distance, avgGrade float64) float64 {
+	return distance * avgGrade
+}
+
+// Returns the category of a climb [0, 5] from its score, on the same scale as
+// SegmentSummary.ClimbCategory: 0 is uncategorized, 1 is category 4 and 5 is Hors catégorie.
+func ClimbCategory(distance, avgGrade float64) int8 {
+	if avgGrade < minCategorizedGrade {
+		return 0
+	}
+
+	score := ClimbScore(distance, avgGrade)
+	var category int8
+	for i, threshold := range climbCategoryScores {
+		if score >= threshold {
+			category = int8(i + 1)
+		}
+	}
+	return category
+}
@@ -0,0 +1,309 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+
+	"github.com/guisaez/gostrava"
+)
+
+const (
+	gradeBinWidth  = 2.0 // Width of the grade bins of a SpeedModel, in percents
+	minGradeBin    = -20 // Center of the lowest grade bin, in percents
+	maxGradeBin    = 20  // Center of the highest grade bin, in percents
+	minBinDuration = 60  // Least time, in seconds, spent at a grade for its bin to be used
+	minModelSpeed  = 0.5 // Samples slower than this, in meters per second, are not used for fitting
+	steepGrade     = 8.0 // Grade, in percents, from which speed is considered proportional to power
+)
+
+type SpeedModelOpts struct {
+	FTP int // The athlete's FTP when the activities were recorded, used to scale predictions to a new FTP
+}
+
+// The speed of an athlete as a function of grade, fitted on their past activities.
+type SpeedModel struct {
+	Grades   []float64 // The center of each grade bin, in percents
+	Speeds   []float64 // The average moving speed at each grade, in meters per second
+	Duration []int     // The moving time spent at each grade, in seconds. Bins with less than a minute are interpolated
+	AvgWatts float64   // The average moving power over the fitted activities, if recorded
+	FTP      int       // The FTP the model was fitted at
+}
+
+// Fits a SpeedModel on past activities of the same sport. Every moving sample contributes the distance
+// and time it covers to the bin of its grade, so each bin holds the average speed at that grade. Grades
+// without enough data are interpolated from their neighbours, and grades beyond the data keep the speed
+// of the closest grade with some. Sets without distance or grade, such as treadmill runs and indoor
+// rides, are skipped; ErrNoSamples is returned when no set has enough data.
+func FitSpeedModel(sets []*gostrava.StreamSet, opts SpeedModelOpts) (*SpeedModel, error) {
+	bins := int((maxGradeBin-minGradeBin)/gradeBinWidth) + 1
+	distance := make([]float64, bins)
+	duration := make([]int, bins)
+
+	var watts float64
+	var wattsTime int
+	for _, set := range sets {
+		if set == nil {
+			return nil, ErrNilStreamSet
+		}
+
+		dist := sampleDistances(set)
+		n := len(dist)
+		grades := sampleGrades(set, n)
+		if dist == nil || grades == nil {
+			continue
+		}
+		t := sampleTimes(set, n)
+		moving := movingMask(set, n)
+
+		for i := 1; i < n; i++ {
+			dt := t[i] - t[i-1]
+			d := dist[i] - dist[i-1]
+			if !moving[i] || dt < 1 || dt > defaultMaxGap || d/float64(dt) < minModelSpeed {
+				continue
+			}
+
+			b := gradeBin(grades[i])
+			distance[b] += d
+			duration[b] += dt
+
+			if s := set.WattsStream; s != nil && i < len(s.Data) {
+				watts += float64(s.Data[i] * dt)
+				wattsTime += dt
+			}
+		}
+	}
+
+	m := &SpeedModel{
+		Grades:   make([]float64, bins),
+		Speeds:   make([]float64, bins),
+		Duration: duration,
+		FTP:      opts.FTP,
+	}
+	if wattsTime > 0 {
+		m.AvgWatts = watts / float64(wattsTime)
+	}
+
+	known := []int{}
+	for b := range m.Grades {
+		m.Grades[b] = minGradeBin + float64(b)*gradeBinWidth
+		if duration[b] >= minBinDuration {
+			m.Speeds[b] = distance[b] / float64(duration[b])
+			known = append(known, b)
+		}
+	}
+	if len(known) == 0 {
+		return nil, ErrNoSamples
+	}
+
+	// Fill the bins without enough data from the closest known ones
+	for b := range m.Speeds {
+		k := sort.SearchInts(known, b)
+		switch {
+		case k < len(known) && known[k] == b:
+		case k == 0:
+			m.Speeds[b] = m.Speeds[known[0]]
+		case k == len(known):
+			m.Speeds[b] = m.Speeds[known[len(known)-1]]
+		default:
+			lo, hi := known[k-1], known[k]
+			f := float64(b-lo) / float64(hi-lo)
+			m.Speeds[b] = m.Speeds[lo] + f*(m.Speeds[hi]-m.Speeds[lo])
+		}
+	}
+
+	return m, nil
+}
+
+func gradeBin(grade float64) int {
+	b := int(math.Round((grade - minGradeBin) / gradeBinWidth))
+	return max(0, min(b, int((maxGradeBin-minGradeBin)/gradeBinWidth)))
+}
+
+// Returns the predicted speed, in meters per second, at the given grade in percents.
+func (m *SpeedModel) Speed(grade float64) float64 {
+	x := (clampGrade(grade) - minGradeBin) / gradeBinWidth
+	lo := max(0, min(int(math.Floor(x)), len(m.Speeds)-1))
+	hi := min(lo+1, len(m.Speeds)-1)
+	f := math.Max(0, math.Min(1, x-float64(lo)))
+	return m.Speeds[lo] + f*(m.Speeds[hi]-m.Speeds[lo])
+}
+
+type ETAOpts struct {
+	Intensity   float64 // The effort relative to the fitted activities, e.g. 1.1 for 10% more power. Defaults to 1
+	FTP         int     // The athlete's current FTP. Scales the intensity by its ratio to SpeedModel.FTP when both are set
+	TargetWatts float64 // The planned average power, in watts. Replaces Intensity and FTP by its ratio to SpeedModel.AvgWatts
+}
+
+type WaypointETA struct {
+	Waypoint   gostrava.Waypoint // The waypoint of the route
+	MovingTime int               // The predicted moving time from the start of the route, in seconds
+}
+
+type ClimbETA struct {
+	Climb      ClimbSegment // The climb, as found by DetectClimbs
+	StartTime  int          // The predicted moving time from the start of the route to the bottom of the climb, in seconds
+	MovingTime int          // The predicted time to ride or run the climb, in seconds
+}
+
+type RouteETA struct {
+	MovingTime int           // The predicted moving time of the whole route, in seconds
+	Distance   float64       // The distance of the route, in meters
+	AvgSpeed   float64       // The predicted average moving speed, in meters per second
+	Times      []float64     // The predicted moving time at every sample of the route's streams, in seconds
+	Waypoints  []WaypointETA // The predicted arrival at each waypoint, in order of DistanceIntoRoute
+	Climbs     []ClimbETA    // The predicted time on each climb of the route
+}
+
+// Predicts the moving time of a route from its streams, as returned by StreamsService.GetRouteStreams
+// and converted with gostrava.NewStreamSet, which must include altitude and distance. Every stretch of
+// the route is covered at the model's speed for its grade. Intensity scales power: speed scales with the
+// cube root of power on the flat and downhill, where drag dominates, and linearly with it on steep
+// climbs, where gravity does. opts.TargetWatts requires a model fitted on activities with power, and
+// returns ErrInvalidOpts otherwise.
+//
+// Waypoints are timed at their DistanceIntoRoute. Those without one are located from their LatLng,
+// at the closest point of the route's LatLngStream, when the set has one.
+func PredictRoute(route *gostrava.RouteDetailed, routeSet *gostrava.StreamSet, model *SpeedModel, opts ETAOpts) (*RouteETA, error) {
+	if routeSet == nil {
+		return nil, ErrNilStreamSet
+	}
+	if model == nil || len(model.Speeds) == 0 {
+		return nil, ErrInvalidOpts
+	}
+	if opts.Intensity <= 0 {
+		opts.Intensity = 1
+	}
+	if opts.FTP > 0 && model.FTP > 0 {
+		opts.Intensity *= float64(opts.FTP) / float64(model.FTP)
+	}
+	if opts.TargetWatts > 0 {
+		if model.AvgWatts <= 0 {
+			return nil, ErrInvalidOpts
+		}
+		opts.Intensity = opts.TargetWatts / model.AvgWatts
+	}
+
+	dist := sampleDistances(routeSet)
+	if dist == nil {
+		return nil, missingStream("distance")
+	}
+	n := len(dist)
+	if n == 0 {
+		return nil, ErrNoSamples
+	}
+	grades := sampleGrades(routeSet, n)
+	if grades == nil {
+		return nil, missingGradeStream(routeSet)
+	}
+
+	eta := &RouteETA{Times: make([]float64, n), Distance: dist[n-1] - dist[0]}
+	for i := 1; i < n; i++ {
+		grade := (grades[i-1] + grades[i]) / 2
+		speed := model.Speed(grade) * intensityFactor(opts.Intensity, grade)
+		eta.Times[i] = eta.Times[i-1]
+		if d := dist[i] - dist[i-1]; d > 0 && speed > 0 {
+			eta.Times[i] += d / speed
+		}
+	}
+	eta.MovingTime = int(math.Round(eta.Times[n-1]))
+	if eta.MovingTime > 0 {
+		eta.AvgSpeed = eta.Distance / eta.Times[n-1]
+	}
+
+	if route != nil {
+		distances := waypointDistances(route.Waypoints, routeSet, dist)
+		order := make([]int, len(route.Waypoints))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool { return distances[order[i]] < distances[order[j]] })
+
+		eta.Waypoints = make([]WaypointETA, len(order))
+		for i, w := range order {
+			eta.Waypoints[i] = WaypointETA{Waypoint: route.Waypoints[w], MovingTime: int(math.Round(timeAt(dist, eta.Times, distances[w])))}
+		}
+	}
+
+	eta.Climbs = []ClimbETA{}
+	if routeSet.AltitudeStream != nil {
+		climbs, err := DetectClimbs(routeSet, ElevationOpts{})
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range climbs {
+			start, end := eta.Times[c.StartIndex], eta.Times[c.EndIndex]
+			eta.Climbs = append(eta.Climbs, ClimbETA{
+				Climb:      c,
+				StartTime:  int(math.Round(start)),
+				MovingTime: int(math.Round(end - start)),
+			})
+		}
+	}
+
+	return eta, nil
+}
+
+// Returns the error for a set sampleGrades cannot compute grades of: it needs a SmoothGradeStream, or
+// both an AltitudeStream and a DistanceStream.
+func missingGradeStream(set *gostrava.StreamSet) error {
+	if set.AltitudeStream == nil {
+		return missingStream("altitude")
+	}
+	return missingStream("distance")
+}
+
+// Returns the distance into the route of each waypoint: its DistanceIntoRoute or, when it has none,
+// the distance of the closest point of the route's LatLngStream to its LatLng.
+func waypointDistances(waypoints []gostrava.Waypoint, routeSet *gostrava.StreamSet, dist []float64) []float64 {
+	distances := make([]float64, len(waypoints))
+
+	var proj projection
+	var routePath path
+	located := routeSet.LatLngStream != nil && len(routeSet.LatLngStream.Data) >= len(dist) && len(dist) > 1
+	if located {
+		points := routeSet.LatLngStream.Data[:len(dist)]
+		proj = newProjection(points[0])
+		routePath = newPath(proj.points(points))
+	}
+
+	for i, w := range waypoints {
+		distances[i] = float64(w.DistanceIntoRoute)
+		if w.DistanceIntoRoute != 0 || w.LatLng == (gostrava.LatLng{}) || !located {
+			continue
+		}
+
+		_, along, e := routePath.nearest(proj.point(w.LatLng), 0, len(routePath.pts))
+		f := 0.0
+		if span := routePath.cum[e+1] - routePath.cum[e]; span > 0 {
+			f = (along - routePath.cum[e]) / span
+		}
+		distances[i] = dist[e] + f*(dist[e+1]-dist[e])
+	}
+
+	return distances
+}
+
+// Returns the factor applied to the speed at the given grade when riding at the given intensity.
+func intensityFactor(intensity, grade float64) float64 {
+	if intensity == 1 {
+		return 1
+	}
+	steep := math.Max(0, math.Min(1, grade/steepGrade))
+	exponent := 1.0/3 + steep*2/3
+	return math.Pow(intensity, exponent)
+}
+
+// Returns the predicted time at the given distance, interpolated between samples.
+func timeAt(dist, times []float64, distance float64) float64 {
+	i := sort.SearchFloat64s(dist, distance)
+	if i == 0 {
+		return times[0]
+	}
+	if i == len(dist) {
+		return times[len(times)-1]
+	}
+	if span := dist[i] - dist[i-1]; span > 0 {
+		return times[i-1] + (distance-dist[i-1])/span*(times[i]-times[i-1])
+	}
+	return times[i]
+}
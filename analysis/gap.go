@@ -0,0 +1,150 @@
+package analysis
+
+import (
+	"math"
+
+	"github.com/guisaez/gostrava"
+)
+
+const (
+	gradeWindow = 50.0 // Distance, in meters, over which grade is derived from altitude
+	maxGrade    = 45.0 // Grades are clamped to this absolute value, in percents
+)
+
+// Returns the grade, in percents, of each of the first n samples. It uses the SmoothGradeStream when
+// available, otherwise the grade is derived from AltitudeStream and DistanceStream over a window
+// centered on each sample. Returns nil when neither is available.
+func sampleGrades(set *gostrava.StreamSet, n int) []float64 {
+	if set.SmoothGradeStream != nil && len(set.SmoothGradeStream.Data) >= n {
+		grades := make([]float64, n)
+		for i := range grades {
+			grades[i] = clampGrade(float64(set.SmoothGradeStream.Data[i]))
+		}
+		return grades
+	}
+
+	if set.AltitudeStream == nil || set.DistanceStream == nil ||
+		len(set.AltitudeStream.Data) < n || len(set.DistanceStream.Data) < n {
+		return nil
+	}
+
+	alt, dist := set.AltitudeStream.Data, set.DistanceStream.Data
+	grades := make([]float64, n)
+
+	lo, hi := 0, 0
+	for i := range grades {
+		for lo < i && dist[i]-dist[lo] > gradeWindow/2 {
+			lo++
+		}
+		for hi+1 < n && dist[hi+1]-dist[i] <= gradeWindow/2 {
+			hi++
+		}
+		if d := float64(dist[hi] - dist[lo]); d > 0 {
+			grades[i] = clampGrade(float64(alt[hi]-alt[lo]) / d * 100)
+		} else if i > 0 {
+			grades[i] = grades[i-1]
+		}
+	}
+
+	return grades
+}
+
+func clampGrade(grade float64) float64 {
+	return math.Max(-maxGrade, math.Min(maxGrade, grade))
+}
+
+// A grade-adjusted pace model. Returns the ratio between the effort of running at the given grade,
+// in percents, and running on the flat.
+type GradeModel func(grade float64) float64
+
+// Minetti is the energy cost of running on slopes measured by Minetti et al. (2002).
+func Minetti(grade float64) float64 {
+	i := grade / 100
+	cost := 155.4*math.Pow(i, 5) - 30.4*math.Pow(i, 4) - 43.3*math.Pow(i, 3) + 46.3*i*i + 19.5*i + 3.6
+	return cost / 3.6
+}
+
+// StravaModel is a quadratic approximation of the heart rate based curve published by Strava in
+// 2017, which is gentler than Minetti on steep climbs and does not reward steep descents.
+func StravaModel(grade float64) float64 {
+	return math.Max(0.5, 1+0.0301*grade+0.00178*grade*grade)
+}
+
+type GradeAdjusted struct {
+	Stream                *gostrava.SmoothVelocityStream // The grade-adjusted speed of every sample, in meters per second
+	Distance              float64                        // The distance covered while moving, in meters
+	FlatDistance          float64                        // The equivalent distance on the flat, in meters
+	MovingTime            int                            // The moving time, in seconds
+	AvgSpeed              float64                        // The average moving speed, in meters per second
+	AvgGradeAdjustedSpeed float64                        // The average grade-adjusted speed, in meters per second
+}
+
+// Returns the average grade-adjusted pace, in seconds per kilometer.
+func (g *GradeAdjusted) Pace() float64 {
+	if g.AvgGradeAdjustedSpeed == 0 {
+		return 0
+	}
+	return Kilometer / g.AvgGradeAdjustedSpeed
+}
+
+// Computes the grade-adjusted speed of a running activity or segment effort from its streams. Grade
+// comes from SmoothGradeStream, or is derived from AltitudeStream and DistanceStream, and speed from
+// SmoothVelocityStream or DistanceStream and TimeStream. The model defaults to Minetti.
+func GradeAdjustedSpeed(set *gostrava.StreamSet, model GradeModel) (*GradeAdjusted, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.DistanceStream == nil {
+		return nil, missingStream("distance")
+	}
+	if model == nil {
+		model = Minetti
+	}
+
+	n := sampleCount(set, len(set.DistanceStream.Data))
+	if n == 0 {
+		return nil, ErrNoSamples
+	}
+
+	grades := sampleGrades(set, n)
+	if grades == nil {
+		return nil, missingStream("grade_smooth")
+	}
+
+	t := sampleTimes(set, n)
+	moving := movingMask(set, n)
+	dist := set.DistanceStream.Data
+
+	g := &GradeAdjusted{
+		Stream: &gostrava.SmoothVelocityStream{Data: make([]float32, n)},
+	}
+	g.Stream.Type = "velocity_smooth"
+	g.Stream.OriginalSize = n
+	g.Stream.SeriesType = "time"
+
+	for i := 0; i < n; i++ {
+		var speed float64
+		if set.SmoothVelocityStream != nil && i < len(set.SmoothVelocityStream.Data) {
+			speed = float64(set.SmoothVelocityStream.Data[i])
+		} else if i > 0 && t[i] > t[i-1] {
+			speed = float64(dist[i]-dist[i-1]) / float64(t[i]-t[i-1])
+		}
+
+		factor := model(grades[i])
+		g.Stream.Data[i] = float32(speed * factor)
+
+		if i > 0 && moving[i] {
+			d := float64(dist[i] - dist[i-1])
+			g.Distance += d
+			g.FlatDistance += d * factor
+			g.MovingTime += t[i] - t[i-1]
+		}
+	}
+
+	if g.MovingTime > 0 {
+		g.AvgSpeed = g.Distance / float64(g.MovingTime)
+		g.AvgGradeAdjustedSpeed = g.FlatDistance / float64(g.MovingTime)
+	}
+
+	return g, nil
+}
@@ -0,0 +1,121 @@
+package analysis
+
+import (
+	"math"
+
+	"github.com/guisaez/gostrava"
+)
+
+// Mean radius of the Earth, in meters.
+const earthRadius = 6371008.8
+
+// A position on a local plane, in meters.
+type point struct {
+	x, y float64
+}
+
+func (p point) distance(q point) float64 {
+	return math.Hypot(p.x-q.x, p.y-q.y)
+}
+
+// An equirectangular projection centered on a reference coordinate. It is accurate enough for the
+// distances of a single activity and much cheaper than great-circle math.
+type projection struct {
+	lat0, lng0, cosLat0 float64
+}
+
+func newProjection(ref gostrava.LatLng) projection {
+	lat0 := float64(ref[0]) * math.Pi / 180
+	return projection{lat0: lat0, lng0: float64(ref[1]) * math.Pi / 180, cosLat0: math.Cos(lat0)}
+}
+
+func (p projection) point(ll gostrava.LatLng) point {
+	lat := float64(ll[0]) * math.Pi / 180
+	lng := float64(ll[1]) * math.Pi / 180
+	return point{x: earthRadius * (lng - p.lng0) * p.cosLat0, y: earthRadius * (lat - p.lat0)}
+}
+
+// Returns the coordinate of a position on the plane.
+func (p projection) latLng(q point) gostrava.LatLng {
+	lat := q.y/earthRadius + p.lat0
+	lng := q.x/(earthRadius*p.cosLat0) + p.lng0
+	return gostrava.LatLng{float32(lat * 180 / math.Pi), float32(lng * 180 / math.Pi)}
+}
+
+func (p projection) points(lls []gostrava.LatLng) []point {
+	pts := make([]point, len(lls))
+	for i, ll := range lls {
+		pts[i] = p.point(ll)
+	}
+	return pts
+}
+
+// A polyline on the local plane along with the cumulative distance at each vertex.
+type path struct {
+	pts []point
+	cum []float64
+}
+
+func newPath(pts []point) path {
+	p := path{pts: pts, cum: make([]float64, len(pts))}
+	for i := 1; i < len(pts); i++ {
+		p.cum[i] = p.cum[i-1] + pts[i-1].distance(pts[i])
+	}
+	return p
+}
+
+func (p path) length() float64 {
+	if len(p.cum) == 0 {
+		return 0
+	}
+	return p.cum[len(p.cum)-1]
+}
+
+// Returns the distance from q to the closest point of the edges [from, to) of the path, the distance
+// along the path of that point and the edge it lies on.
+func (p path) nearest(q point, from, to int) (dist, along float64, edge int) {
+	dist = math.Inf(1)
+	if len(p.pts) == 1 {
+		return q.distance(p.pts[0]), 0, 0
+	}
+
+	from = max(from, 0)
+	to = min(to, len(p.pts)-1)
+	for e := from; e < to; e++ {
+		d, t := segmentDistance(q, p.pts[e], p.pts[e+1])
+		if d < dist {
+			dist, edge = d, e
+			along = p.cum[e] + t*(p.cum[e+1]-p.cum[e])
+		}
+	}
+
+	return dist, along, edge
+}
+
+// Returns the point of the path at the given distance along it.
+func (p path) at(along float64) point {
+	if len(p.pts) == 0 {
+		return point{}
+	}
+	for e := 1; e < len(p.pts); e++ {
+		if p.cum[e] >= along {
+			span := p.cum[e] - p.cum[e-1]
+			if span == 0 {
+				return p.pts[e]
+			}
+			t := (along - p.cum[e-1]) / span
+			a, b := p.pts[e-1], p.pts[e]
+			return point{x: a.x + (b.x-a.x)*t, y: a.y + (b.y-a.y)*t}
+		}
+	}
+	return p.pts[len(p.pts)-1]
+}
+
+// Returns the distance from q to the segment ab and the position of the closest point along it, from 0 at a to 1 at b.
+func segmentDistance(q, a, b point) (dist, t float64) {
+	dx, dy := b.x-a.x, b.y-a.y
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, ((q.x-a.x)*dx+(q.y-a.y)*dy)/l))
+	}
+	return q.distance(point{x: a.x + t*dx, y: a.y + t*dy}), t
+}
@@ -0,0 +1,409 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/guisaez/gostrava"
+)
+
+const (
+	defaultIntervalSmoothing   = 10 // seconds
+	defaultIntervalMinDuration = 30 // seconds
+	intervalSimilarity         = 0.15
+	thresholdIterations        = 50
+)
+
+type IntervalOpts struct {
+	Threshold   float64 // Value separating work from recovery, in watts or meters per second. Defaults to splitting the samples into two clusters
+	Smoothing   int     // Length of the rolling average applied before classifying samples, in seconds. Defaults to 10
+	MinDuration int     // Bouts shorter than this, in seconds, are merged into their neighbours. Defaults to 30
+}
+
+type Interval struct {
+	gostrava.Lap
+	Work     bool    // Whether this is a work bout, otherwise it is a recovery bout
+	AvgWatts float64 // The average power of the bout, in watts, when the set has a PowerStream
+}
+
+type Workout struct {
+	Intervals []Interval // The work and recovery bouts, covering the whole activity
+	Threshold float64    // The threshold used to separate work from recovery
+	Summary   string     // The structure of the work bouts, for example "6x3min @ 320W"
+}
+
+// Segments the PowerStream of the set into work and recovery bouts.
+func DetectPowerIntervals(set *gostrava.StreamSet, opts IntervalOpts) (*Workout, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.WattsStream == nil {
+		return nil, missingStream("watts")
+	}
+
+	signal := make([]float64, sampleCount(set, len(set.WattsStream.Data)))
+	for i := range signal {
+		signal[i] = float64(set.WattsStream.Data[i])
+	}
+
+	return detectIntervals(set, signal, opts, func(v float64) string {
+		return fmt.Sprintf("%.0fW", v)
+	})
+}
+
+// Segments the SmoothVelocityStream of the set into work and recovery bouts.
+func DetectSpeedIntervals(set *gostrava.StreamSet, opts IntervalOpts) (*Workout, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.SmoothVelocityStream == nil {
+		return nil, missingStream("velocity_smooth")
+	}
+
+	signal := make([]float64, sampleCount(set, len(set.SmoothVelocityStream.Data)))
+	for i := range signal {
+		signal[i] = float64(set.SmoothVelocityStream.Data[i])
+	}
+
+	return detectIntervals(set, signal, opts, func(v float64) string {
+		if v <= 0 {
+			return "0:00/km"
+		}
+		pace := int(math.Round(Kilometer / v))
+		return fmt.Sprintf("%d:%02d/km", pace/60, pace%60)
+	})
+}
+
+// A run of samples of the same class, from start to end exclusive.
+type bout struct {
+	start, end int
+	work       bool
+}
+
+func detectIntervals(set *gostrava.StreamSet, signal []float64, opts IntervalOpts, format func(float64) string) (*Workout, error) {
+	if len(signal) < 2 {
+		return nil, ErrNoSamples
+	}
+	if opts.Smoothing <= 0 {
+		opts.Smoothing = defaultIntervalSmoothing
+	}
+	if opts.MinDuration <= 0 {
+		opts.MinDuration = defaultIntervalMinDuration
+	}
+
+	t := sampleTimes(set, len(signal))
+	smooth := rollingAverage(t, signal, opts.Smoothing)
+
+	if opts.Threshold <= 0 {
+		opts.Threshold = twoMeansThreshold(smooth)
+	}
+
+	// Classify the smoothed samples and cut them into bouts
+	var bouts []bout
+	for i, v := range smooth {
+		work := v >= opts.Threshold
+		if len(bouts) == 0 || bouts[len(bouts)-1].work != work {
+			bouts = append(bouts, bout{start: i, work: work})
+		}
+		bouts[len(bouts)-1].end = i + 1
+	}
+
+	bouts = mergeShortBouts(bouts, t, opts.MinDuration)
+	refineBoundaries(bouts, t, signal, opts.Smoothing)
+
+	w := &Workout{Threshold: opts.Threshold}
+	moving := movingMask(set, len(signal))
+	work, recovery := 0, 0
+	for i, b := range bouts {
+		interval := boutInterval(set, t, moving, b)
+		interval.LapIndex = i
+		interval.Split = i + 1
+		if b.work {
+			work++
+			interval.Name = fmt.Sprintf("Work %d", work)
+		} else {
+			recovery++
+			interval.Name = fmt.Sprintf("Recovery %d", recovery)
+		}
+		w.Intervals = append(w.Intervals, interval)
+	}
+
+	w.Summary = summarizeWorkout(w.Intervals, signal, format)
+
+	return w, nil
+}
+
+// Returns the average of the samples within a window of the given number of seconds centered on each sample.
+func rollingAverage(t []int, values []float64, window int) []float64 {
+	avg := make([]float64, len(values))
+
+	var sum float64
+	lo, hi := 0, -1
+	for i := range values {
+		for hi+1 < len(values) && t[hi+1]-t[i] <= window/2 {
+			hi++
+			sum += values[hi]
+		}
+		for t[i]-t[lo] > window/2 {
+			sum -= values[lo]
+			lo++
+		}
+		avg[i] = sum / float64(hi-lo+1)
+	}
+
+	return avg
+}
+
+// Returns the threshold splitting the values into two clusters, iterating the midpoint between the
+// means of the values above and below it until it settles.
+func twoMeansThreshold(values []float64) float64 {
+	var threshold float64
+	for _, v := range values {
+		threshold += v
+	}
+	threshold /= float64(len(values))
+
+	for i := 0; i < thresholdIterations; i++ {
+		var low, high float64
+		var nLow, nHigh int
+		for _, v := range values {
+			if v >= threshold {
+				high += v
+				nHigh++
+			} else {
+				low += v
+				nLow++
+			}
+		}
+		if nLow == 0 || nHigh == 0 {
+			break
+		}
+
+		next := (low/float64(nLow) + high/float64(nHigh)) / 2
+		if math.Abs(next-threshold) < 1e-6 {
+			break
+		}
+		threshold = next
+	}
+
+	return threshold
+}
+
+// Merges bouts shorter than minDuration, shortest first, into their neighbours until none is left.
+func mergeShortBouts(bouts []bout, t []int, minDuration int) []bout {
+	duration := func(b bout) int { return t[b.end-1] - t[b.start] + 1 }
+
+	for len(bouts) > 1 {
+		shortest := -1
+		for i, b := range bouts {
+			if duration(b) < minDuration && (shortest < 0 || duration(b) < duration(bouts[shortest])) {
+				shortest = i
+			}
+		}
+		if shortest < 0 {
+			break
+		}
+
+		// Flipping the class of the bout merges it with both of its neighbours
+		bouts[shortest].work = !bouts[shortest].work
+
+		merged := bouts[:1]
+		for _, b := range bouts[1:] {
+			if last := &merged[len(merged)-1]; last.work == b.work {
+				last.end = b.end
+			} else {
+				merged = append(merged, b)
+			}
+		}
+		bouts = merged
+	}
+
+	return bouts
+}
+
+// Moves every boundary between bouts to the change point nearby, the sample within the smoothing
+// window that maximizes the difference between the raw averages on either side of it.
+func refineBoundaries(bouts []bout, t []int, signal []float64, window int) {
+	prefix := make([]float64, len(signal)+1)
+	for i, v := range signal {
+		prefix[i+1] = prefix[i] + v
+	}
+	mean := func(from, to int) float64 { return (prefix[to] - prefix[from]) / float64(to-from) }
+
+	for i := 1; i < len(bouts); i++ {
+		prev, next := &bouts[i-1], &bouts[i]
+		best, bestScore := next.start, -1.0
+
+		from, to := next.start, next.start
+		for from > prev.start+1 && t[next.start]-t[from-1] <= window {
+			from--
+		}
+		for to < next.end-1 && t[to+1]-t[next.start] <= window {
+			to++
+		}
+
+		for b := from; b <= to; b++ {
+			lo, hi := b, b
+			for lo > prev.start && t[b]-t[lo-1] <= window {
+				lo--
+			}
+			for hi < next.end && t[hi]-t[b] < window {
+				hi++
+			}
+
+			if score := math.Abs(mean(lo, b) - mean(b, hi)); score > bestScore {
+				best, bestScore = b, score
+			}
+		}
+
+		prev.end, next.start = best, best
+	}
+}
+
+// Computes the lap fields of a bout from the streams of the set. Times and distances run up to the
+// first sample of the next bout, so consecutive laps add up to the whole activity.
+func boutInterval(set *gostrava.StreamSet, t []int, moving []bool, b bout) Interval {
+	last := b.end - 1
+	stop := b.end
+	if stop == len(t) {
+		stop = last
+	}
+
+	interval := Interval{Work: b.work}
+	lap := &interval.Lap
+
+	lap.StartIndex = b.start
+	lap.EndIndex = last
+	lap.ElapsedTime = t[stop] - t[b.start]
+	lap.MovingTime = movingTime(t, moving, b.start, stop)
+
+	if s := set.DistanceStream; s != nil && stop < len(s.Data) {
+		lap.Distance = s.Data[stop] - s.Data[b.start]
+		if lap.MovingTime > 0 {
+			lap.AvgSpeed = lap.Distance / float32(lap.MovingTime)
+		}
+	}
+
+	if s := set.SmoothVelocityStream; s != nil && last < len(s.Data) {
+		for _, v := range s.Data[b.start : last+1] {
+			if v > lap.MaxSpeed {
+				lap.MaxSpeed = v
+			}
+		}
+	}
+
+	if s := set.AltitudeStream; s != nil && stop < len(s.Data) {
+		for i := b.start + 1; i <= stop; i++ {
+			if gain := s.Data[i] - s.Data[i-1]; gain > 0 {
+				lap.TotalElevationGain += gain
+			}
+		}
+	}
+
+	if s := set.HeartRateStream; s != nil && last < len(s.Data) {
+		avg, max := intAverage(s.Data[b.start : last+1])
+		lap.AvgHeartRate, lap.MaxHeartRate = float32(avg), float32(max)
+	}
+
+	if s := set.CadenceStream; s != nil && last < len(s.Data) {
+		avg, _ := intAverage(s.Data[b.start : last+1])
+		lap.AvgCadence = float32(avg)
+	}
+
+	if s := set.WattsStream; s != nil && last < len(s.Data) {
+		interval.AvgWatts, _ = intAverage(s.Data[b.start : last+1])
+		lap.DeviceWatts = true
+	}
+
+	return interval
+}
+
+// Returns the average and maximum of the values.
+func intAverage(values []int) (float64, int) {
+	var sum, max int
+	for _, v := range values {
+		sum += v
+		if v > max {
+			max = v
+		}
+	}
+	if len(values) == 0 {
+		return 0, 0
+	}
+	return float64(sum) / float64(len(values)), max
+}
+
+// Describes the work bouts of the workout, grouping consecutive bouts of similar duration into sets
+// such as "6x3min @ 320W, 4x1min @ 400W".
+func summarizeWorkout(intervals []Interval, signal []float64, format func(float64) string) string {
+	type group struct {
+		count    int
+		duration int
+		samples  int
+		total    float64
+	}
+
+	var groups []group
+	for _, in := range intervals {
+		if !in.Work {
+			continue
+		}
+
+		var total float64
+		for i := in.StartIndex; i <= in.EndIndex; i++ {
+			total += signal[i]
+		}
+		samples := in.EndIndex - in.StartIndex + 1
+
+		if n := len(groups); n > 0 {
+			g := &groups[n-1]
+			avg := float64(g.duration) / float64(g.count)
+			if math.Abs(float64(in.ElapsedTime)-avg) <= avg*intervalSimilarity {
+				g.count++
+				g.duration += in.ElapsedTime
+				g.samples += samples
+				g.total += total
+				continue
+			}
+		}
+
+		groups = append(groups, group{count: 1, duration: in.ElapsedTime, samples: samples, total: total})
+	}
+
+	parts := make([]string, len(groups))
+	for i, g := range groups {
+		parts[i] = fmt.Sprintf("%dx%s @ %s", g.count, formatDuration(g.duration/g.count), format(g.total/float64(g.samples)))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Formats a duration, in seconds, rounded to the units a coach would use: "45s", "1min30s", "3min", "1h30min".
+func formatDuration(seconds int) string {
+	if seconds < 60 {
+		return fmt.Sprintf("%ds", int(math.Round(float64(seconds)/5))*5)
+	}
+
+	minutes := int(math.Round(float64(seconds) / 60))
+	if minutes >= 60 {
+		if minutes%60 == 0 {
+			return fmt.Sprintf("%dh", minutes/60)
+		}
+		return fmt.Sprintf("%dh%02dmin", minutes/60, minutes%60)
+	}
+
+	if abs(seconds-minutes*60) <= seconds/10 {
+		return fmt.Sprintf("%dmin", minutes)
+	}
+
+	rounded := int(math.Round(float64(seconds)/5)) * 5
+	return fmt.Sprintf("%dmin%02ds", rounded/60, rounded%60)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,202 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/guisaez/gostrava"
+)
+
+// Default time constants of the training load model, in days.
+const (
+	defaultChronicDays = 42
+	defaultAcuteDays   = 7
+)
+
+type LoadEntry struct {
+	ActivityID int       // The activity the load comes from, zero for planned workouts
+	Date       time.Time // The day the load was (or is planned to be) done on
+	Load       float64   // The training load, such as TSS or TRIMP
+	Planned    bool      // Whether this is a planned workout rather than a completed activity
+}
+
+type DailyLoad struct {
+	Date      time.Time // The day, at midnight UTC
+	Load      float64   // The total load of the day
+	CTL       float64   // Chronic Training Load (fitness) at the end of the day
+	ATL       float64   // Acute Training Load (fatigue) at the end of the day
+	TSB       float64   // Training Stress Balance (form) going into the day, yesterday's CTL minus ATL
+	Projected bool      // Whether the day has planned load or is after the last completed activity
+}
+
+type LoadOpts struct {
+	ChronicDays float64   // Time constant of CTL, in days. Defaults to 42
+	AcuteDays   float64   // Time constant of ATL, in days. Defaults to 7
+	InitialCTL  float64   // CTL before the first day
+	InitialATL  float64   // ATL before the first day
+	From        time.Time // The first day of the series. Defaults to the day of the first entry
+	Until       time.Time // The last day of the series. Defaults to the day of the last entry, set it later to project form forward
+}
+
+// Computes daily CTL, ATL and TSB from a history of training loads. Days with planned entries, even
+// before the last completed one, and any day after the last completed entry are flagged as projected,
+// so the same call projects future form.
+func TrainingLoad(entries []LoadEntry, opts LoadOpts) []DailyLoad {
+	if opts.ChronicDays <= 0 {
+		opts.ChronicDays = defaultChronicDays
+	}
+	if opts.AcuteDays <= 0 {
+		opts.AcuteDays = defaultAcuteDays
+	}
+
+	loads := map[time.Time]float64{}
+	planned := map[time.Time]bool{}
+	var first, last, lastCompleted time.Time
+	for _, e := range entries {
+		day := dayOf(e.Date)
+		loads[day] += e.Load
+		planned[day] = planned[day] || e.Planned
+
+		if first.IsZero() || day.Before(first) {
+			first = day
+		}
+		if day.After(last) {
+			last = day
+		}
+		if !e.Planned && day.After(lastCompleted) {
+			lastCompleted = day
+		}
+	}
+
+	if !opts.From.IsZero() {
+		first = dayOf(opts.From)
+	}
+	if !opts.Until.IsZero() {
+		last = dayOf(opts.Until)
+	}
+	if first.IsZero() || last.Before(first) {
+		return nil
+	}
+
+	chronic := 1 - math.Exp(-1/opts.ChronicDays)
+	acute := 1 - math.Exp(-1/opts.AcuteDays)
+	ctl, atl := opts.InitialCTL, opts.InitialATL
+
+	var days []DailyLoad
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		d := DailyLoad{
+			Date:      day,
+			Load:      loads[day],
+			TSB:       ctl - atl,
+			Projected: planned[day] || day.After(lastCompleted),
+		}
+
+		ctl += (d.Load - ctl) * chronic
+		atl += (d.Load - atl) * acute
+		d.CTL, d.ATL = ctl, atl
+
+		days = append(days, d)
+	}
+
+	return days
+}
+
+type LoadEstimateOpts struct {
+	FTP              int    // The athlete's FTP, in watts, usually AthleteDetailed.FTP
+	RestingHeartRate int    // The athlete's resting heart rate, in beats per minute
+	MaxHeartRate     int    // The athlete's maximum heart rate, in beats per minute
+	Sex              string // The athlete's sex, used to weight TRIMP. May take one of the following values: M, F
+}
+
+// Computes Banister's TRIMP from the HeartrateStream and TimeStream of the set. Paused samples are left out.
+func TRIMP(set *gostrava.StreamSet, opts LoadEstimateOpts) (float64, error) {
+	if set == nil {
+		return 0, ErrNilStreamSet
+	}
+	if set.HeartRateStream == nil {
+		return 0, missingStream("heartrate")
+	}
+
+	n := sampleCount(set, len(set.HeartRateStream.Data))
+	if n == 0 {
+		return 0, ErrNoSamples
+	}
+
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = float64(set.HeartRateStream.Data[i])
+	}
+
+	s := perSecond(sampleTimes(set, n), values, movingMask(set, n), defaultMaxGap, false)
+
+	var trimp float64
+	for _, hr := range s.values {
+		trimp += trimpRate(hr, opts) / 60
+	}
+
+	return trimp, nil
+}
+
+// Returns the TRIMP accumulated per minute at the given heart rate.
+func trimpRate(hr float64, opts LoadEstimateOpts) float64 {
+	if opts.MaxHeartRate <= opts.RestingHeartRate || hr <= 0 {
+		return 0
+	}
+
+	reserve := (hr - float64(opts.RestingHeartRate)) / float64(opts.MaxHeartRate-opts.RestingHeartRate)
+	reserve = math.Max(0, math.Min(1, reserve))
+
+	if opts.Sex == "F" {
+		return reserve * 0.86 * math.Exp(1.67*reserve)
+	}
+	return reserve * 0.64 * math.Exp(1.92*reserve)
+}
+
+// Estimates the training load of an activity from its summary fields, for activities whose streams
+// are not available. In order of preference it uses a TSS from AvgWatts and FTP for activities with
+// a power meter, the SufferScore (Relative Effort), or a TRIMP from AvgHeartRate over MovingTime.
+// Returns zero when none of them can be computed.
+func EstimateLoad(activity gostrava.ActivitySummary, opts LoadEstimateOpts) float64 {
+	hours := float64(activity.MovingTime) / 3600
+
+	if activity.DeviceWatts && activity.AvgWatts > 0 && opts.FTP > 0 {
+		intensity := float64(activity.AvgWatts) / float64(opts.FTP)
+		return hours * intensity * intensity * 100
+	}
+
+	if activity.SufferScore != nil {
+		return float64(*activity.SufferScore)
+	}
+
+	if activity.HasHeartRate && activity.AvgHeartRate > 0 {
+		return trimpRate(float64(activity.AvgHeartRate), opts) * hours * 60
+	}
+
+	return 0
+}
+
+// Builds load entries for a history of activities, such as the one returned by
+// CurrentAthleteService.ListActivities, estimating each load with EstimateLoad. Entries are
+// dated by the activity's local start date.
+func LoadEntries(activities []gostrava.ActivitySummary, opts LoadEstimateOpts) []LoadEntry {
+	entries := make([]LoadEntry, 0, len(activities))
+	for _, a := range activities {
+		entries = append(entries, LoadEntry{
+			ActivityID: a.ID,
+			Date:       a.StartDateLocal.Time,
+			Load:       EstimateLoad(a, opts),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Date.Before(entries[j].Date) })
+
+	return entries
+}
+
+// Returns the calendar day of t, at midnight UTC. The zone of t is kept when picking the day, so
+// local start dates stay on their local day.
+func dayOf(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,226 @@
+package analysis
+
+import (
+	"github.com/guisaez/gostrava"
+)
+
+// Length of the window, in seconds, over which speed is derived from distance or positions.
+const speedWindow = 5
+
+type AutoPauseOpts struct {
+	MinSpeed float64 // Speed, in meters per second, below which the athlete is considered stopped
+	MaxGap   int     // Gaps between samples longer than this, in seconds, are pauses. Defaults to 10
+	MinStop  int     // Stops shorter than this, in seconds, are not paused, so brief slowdowns keep counting as moving
+}
+
+// Returns the auto-pause thresholds suited to the given sport.
+func AutoPauseFor(sport gostrava.SportType) AutoPauseOpts {
+	opts := AutoPauseOpts{MaxGap: defaultMaxGap}
+
+	switch sport {
+	case gostrava.RideSport, gostrava.MountainBikeRideSport, gostrava.GravelRideSport, gostrava.EBikeRideSport,
+		gostrava.EMountainBikeRideSport, gostrava.VirtualRideSport, gostrava.VelomobileSport, gostrava.HandcycleSport:
+		opts.MinSpeed = 1.0
+		opts.MinStop = 3
+	case gostrava.RunSport, gostrava.TrailRunSport, gostrava.VirtualRunSport, gostrava.AlpineSkiSport,
+		gostrava.BackcountrySkiSport, gostrava.NordicSkiSport, gostrava.RollerSkiSport, gostrava.InlineSkateSport:
+		opts.MinSpeed = 0.5
+		opts.MinStop = 5
+	case gostrava.WalkSportType, gostrava.HikeSport, gostrava.SnowshoeSport:
+		opts.MinSpeed = 0.3
+		opts.MinStop = 10
+	case gostrava.SwimSport, gostrava.RowingSport, gostrava.KayakingSport, gostrava.CanoeingSport, gostrava.StandUpPaddlingSport:
+		opts.MinSpeed = 0.2
+		opts.MinStop = 5
+	default:
+		opts.MinSpeed = 0.4
+		opts.MinStop = 5
+	}
+
+	return opts
+}
+
+// Derives whether the athlete was moving at each sample of the set. Speed comes from the
+// SmoothVelocityStream, or is derived from the DistanceStream or the LatLngStream over a few
+// seconds, so sets built from imported GPX, TCX or FIT files work as well as Strava streams.
+func MovingMask(set *gostrava.StreamSet, opts AutoPauseOpts) ([]bool, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if opts.MaxGap <= 0 {
+		opts.MaxGap = defaultMaxGap
+	}
+
+	speed, err := sampleSpeeds(set)
+	if err != nil {
+		return nil, err
+	}
+
+	t := sampleTimes(set, len(speed))
+	mask := make([]bool, len(speed))
+	for i := range mask {
+		gap := i > 0 && t[i]-t[i-1] > opts.MaxGap
+		mask[i] = !gap && speed[i] >= opts.MinSpeed
+	}
+
+	// Keep counting short stops as moving
+	for i := 0; i < len(mask); {
+		if mask[i] {
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(mask) && !mask[j] {
+			j++
+		}
+
+		brief := i > 0 && j < len(mask) && t[j-1]-t[i]+1 < opts.MinStop
+		for k := i; brief && k < j; k++ {
+			mask[k] = t[k]-t[k-1] <= opts.MaxGap
+		}
+		i = j
+	}
+
+	return mask, nil
+}
+
+// Recomputes the MovingStream of the set with the given auto-pause thresholds, so that every other
+// computation of this package uses it.
+func ApplyAutoPause(set *gostrava.StreamSet, opts AutoPauseOpts) error {
+	mask, err := MovingMask(set, opts)
+	if err != nil {
+		return err
+	}
+
+	set.MovingStream = &gostrava.MovingStream{Data: mask}
+	set.MovingStream.Type = "moving"
+	set.MovingStream.OriginalSize = len(mask)
+	set.MovingStream.SeriesType = "time"
+
+	return nil
+}
+
+type MovingSummary struct {
+	ElapsedTime int     // The elapsed time, in seconds
+	MovingTime  int     // The moving time, in seconds
+	Distance    float64 // The distance covered, in meters
+	AvgSpeed    float64 // The average moving speed, in meters per second
+}
+
+// Computes the moving time and average moving speed of the set according to its MovingStream.
+func MovingStats(set *gostrava.StreamSet) (*MovingSummary, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.TimeStream == nil {
+		return nil, missingStream("time")
+	}
+
+	n := len(set.TimeStream.Data)
+	if n == 0 {
+		return nil, ErrNoSamples
+	}
+
+	return movingStats(set.TimeStream.Data, sampleDistances(set), movingMask(set, n), 0, n-1), nil
+}
+
+// Recomputes the MovingTime and AvgSpeed of each lap from the MovingStream of the set, using the
+// StartIndex and EndIndex of the laps.
+func UpdateLapMovingTimes(set *gostrava.StreamSet, laps []gostrava.Lap) error {
+	if set == nil {
+		return ErrNilStreamSet
+	}
+	if set.TimeStream == nil {
+		return missingStream("time")
+	}
+
+	n := len(set.TimeStream.Data)
+	mask := movingMask(set, n)
+	dist := sampleDistances(set)
+	for i := range laps {
+		start, end := laps[i].StartIndex, laps[i].EndIndex
+		if start < 0 || end >= n || start > end {
+			continue
+		}
+
+		stats := movingStats(set.TimeStream.Data, dist, mask, start, end)
+		laps[i].MovingTime = stats.MovingTime
+		laps[i].AvgSpeed = float32(stats.AvgSpeed)
+	}
+
+	return nil
+}
+
+// Computes the moving statistics between the start and end samples. Distances may be nil.
+func movingStats(t []int, dist []float64, mask []bool, start, end int) *MovingSummary {
+	stats := &MovingSummary{
+		ElapsedTime: t[end] - t[start],
+		MovingTime:  movingTime(t, mask, start, end),
+	}
+
+	if end < len(dist) {
+		stats.Distance = dist[end] - dist[start]
+	}
+	if stats.MovingTime > 0 {
+		stats.AvgSpeed = stats.Distance / float64(stats.MovingTime)
+	}
+
+	return stats
+}
+
+// Returns the speed, in meters per second, at each sample of the set.
+func sampleSpeeds(set *gostrava.StreamSet) ([]float64, error) {
+	if s := set.SmoothVelocityStream; s != nil && len(s.Data) > 0 {
+		n := sampleCount(set, len(s.Data))
+		speed := make([]float64, n)
+		for i := range speed {
+			speed[i] = float64(s.Data[i])
+		}
+		return speed, nil
+	}
+
+	dist := sampleDistances(set)
+	if dist == nil {
+		return nil, missingStream("distance")
+	}
+
+	t := sampleTimes(set, len(dist))
+	speed := make([]float64, len(dist))
+	j := 0
+	for i := 1; i < len(dist); i++ {
+		for j < i-1 && t[i]-t[j] > speedWindow {
+			j++
+		}
+		if dt := t[i] - t[j]; dt > 0 {
+			speed[i] = (dist[i] - dist[j]) / float64(dt)
+		}
+	}
+	if len(speed) > 1 {
+		speed[0] = speed[1]
+	}
+
+	return speed, nil
+}
+
+// Returns the cumulative distance, in meters, at each sample of the set, from its DistanceStream or
+// integrated from its LatLngStream. Returns nil when the set has neither.
+func sampleDistances(set *gostrava.StreamSet) []float64 {
+	if s := set.DistanceStream; s != nil && len(s.Data) > 0 {
+		dist := make([]float64, sampleCount(set, len(s.Data)))
+		for i := range dist {
+			dist[i] = float64(s.Data[i])
+		}
+		return dist
+	}
+
+	if s := set.LatLngStream; s != nil && len(s.Data) > 0 {
+		dist := make([]float64, sampleCount(set, len(s.Data)))
+		for i := 1; i < len(dist); i++ {
+			dist[i] = dist[i-1] + s.Data[i-1].Distance(s.Data[i])
+		}
+		return dist
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package analysis
+
+import (
+	"math"
+
+	"github.com/guisaez/gostrava"
+)
+
+// Length, in seconds, of the rolling average used by Normalized Power.
+const normalizedPowerWindow = 30
+
+type PowerOpts struct {
+	FTP           int  // The athlete's Functional Threshold Power, in watts. IntensityFactor and TrainingStressScore are only computed when set
+	MaxGap        int  // Longest gap between samples, in seconds, that is filled by holding the sample value. Longer gaps are treated as pauses. Defaults to 10
+	IncludePaused bool // Whether samples flagged as not moving by MovingStream count towards the metrics
+}
+
+// Returns the PowerOpts for the given athlete, using AthleteDetailed.FTP as threshold. A nil athlete
+// gives the zero PowerOpts.
+func PowerOptsFor(athlete *gostrava.AthleteDetailed) PowerOpts {
+	if athlete == nil {
+		return PowerOpts{}
+	}
+	return PowerOpts{FTP: athlete.FTP}
+}
+
+type PowerMetrics struct {
+	AvgPower            float64 // The average power over the analysed time, coasting included, in watts
+	MaxPower            int     // The maximum power sample, in watts
+	NormalizedPower     float64 // Normalized Power (NP), in watts
+	IntensityFactor     float64 // Intensity Factor (IF), the ratio between NP and FTP
+	TrainingStressScore float64 // Training Stress Score (TSS)
+	VariabilityIndex    float64 // Variability Index (VI), the ratio between NP and the average power
+	Work                float64 // The total work done, in kilojoules
+	Duration            int     // The analysed time, in seconds. Pauses are excluded
+	CoastingTime        int     // The time spent moving at zero watts, in seconds
+}
+
+// Computes power metrics from the PowerStream of the set. Samples are spread over one second each
+// using the TimeStream, zero and missing samples count as coasting, and periods flagged as not moving
+// by MovingStream are left out as paused unless opts.IncludePaused is set.
+func ComputePower(set *gostrava.StreamSet, opts PowerOpts) (*PowerMetrics, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.WattsStream == nil {
+		return nil, missingStream("watts")
+	}
+	if opts.MaxGap <= 0 {
+		opts.MaxGap = defaultMaxGap
+	}
+
+	n := sampleCount(set, len(set.WattsStream.Data))
+	if n == 0 {
+		return nil, ErrNoSamples
+	}
+
+	t := sampleTimes(set, n)
+	watts := make([]float64, n)
+	for i := range watts {
+		if w := set.WattsStream.Data[i]; w > 0 {
+			watts[i] = float64(w)
+		}
+	}
+
+	var include []bool
+	if !opts.IncludePaused {
+		include = movingMask(set, n)
+	}
+
+	s := perSecond(t, watts, include, opts.MaxGap, false)
+	if len(s.values) == 0 {
+		return nil, ErrNoSamples
+	}
+
+	m := &PowerMetrics{Duration: len(s.values)}
+
+	var total float64
+	for _, w := range s.values {
+		total += w
+		if w == 0 {
+			m.CoastingTime++
+		}
+		if int(w) > m.MaxPower {
+			m.MaxPower = int(w)
+		}
+	}
+
+	m.AvgPower = total / float64(len(s.values))
+	m.Work = total / 1000
+	m.NormalizedPower = normalizedPower(s.values)
+
+	if m.AvgPower > 0 {
+		m.VariabilityIndex = m.NormalizedPower / m.AvgPower
+	}
+
+	if opts.FTP > 0 {
+		ftp := float64(opts.FTP)
+		m.IntensityFactor = m.NormalizedPower / ftp
+		m.TrainingStressScore = float64(m.Duration) * m.NormalizedPower * m.IntensityFactor / (ftp * 3600) * 100
+	}
+
+	return m, nil
+}
+
+// Returns the fourth-power mean of the 30 second rolling average of a one second power series.
+// Series shorter than the window fall back to their plain average.
+func normalizedPower(watts []float64) float64 {
+	if len(watts) < normalizedPowerWindow {
+		var total float64
+		for _, w := range watts {
+			total += w
+		}
+		return total / float64(len(watts))
+	}
+
+	var sum, fourth float64
+	for i, w := range watts {
+		sum += w
+		if i >= normalizedPowerWindow {
+			sum -= watts[i-normalizedPowerWindow]
+		}
+		if i >= normalizedPowerWindow-1 {
+			fourth += math.Pow(sum/normalizedPowerWindow, 4)
+		}
+	}
+
+	return math.Pow(fourth/float64(len(watts)-normalizedPowerWindow+1), 0.25)
+}
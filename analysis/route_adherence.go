@@ -0,0 +1,309 @@
+package analysis
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+
+	"github.com/guisaez/gostrava"
+)
+
+const (
+	defaultAdherenceTolerance = 50 // meters
+	coverageStep              = 10 // meters
+)
+
+type AdherenceOpts struct {
+	Tolerance float64 // Largest distance, in meters, from the route that is still on course. Defaults to 50
+}
+
+type OffCourseSection struct {
+	StartIndex   int     // The index of the first off-course sample in the activity's stream
+	EndIndex     int     // The index of the last off-course sample in the activity's stream
+	Distance     float64 // The distance travelled off course, in meters
+	MaxDeviation float64 // The largest distance from the route during the section, in meters
+}
+
+type Checkpoint struct {
+	Waypoint    gostrava.Waypoint // The waypoint of the route
+	Index       int               // The index of the activity's stream at which the waypoint was passed
+	ElapsedTime int               // The time elapsed since the start of the activity, in seconds
+}
+
+type Adherence struct {
+	Coverage         float64             // The percentage of the route's distance covered by the activity
+	MaxDeviation     float64             // The largest distance between the activity and the route, in meters
+	OffCourse        []OffCourseSection  // The sections of the activity away from the route
+	Checkpoints      []Checkpoint        // The waypoints passed, in route order
+	SkippedWaypoints []gostrava.Waypoint // The waypoints that were not passed
+}
+
+// Compares an activity with the route it was meant to follow. The route geometry comes from its
+// streams, as returned by StreamsService.GetRouteStreams and converted with gostrava.NewStreamSet;
+// when routeSet is nil the route's summary polyline is decoded instead. Waypoints are timed in
+// order of DistanceIntoRoute as the first time the activity passes within the tolerance of them.
+func CompareToRoute(route *gostrava.RouteDetailed, routeSet, activity *gostrava.StreamSet, opts AdherenceOpts) (*Adherence, error) {
+	if activity == nil {
+		return nil, ErrNilStreamSet
+	}
+	if activity.LatLngStream == nil {
+		return nil, missingStream("latlng")
+	}
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = defaultAdherenceTolerance
+	}
+
+	routePoints, err := routeGeometry(route, routeSet)
+	if err != nil {
+		return nil, err
+	}
+
+	n := sampleCount(activity, len(activity.LatLngStream.Data))
+	if n == 0 {
+		return nil, ErrNoSamples
+	}
+
+	proj := newProjection(routePoints[0])
+	routePath := newPath(proj.points(routePoints))
+	track := proj.points(activity.LatLngStream.Data[:n])
+	t := sampleTimes(activity, n)
+
+	a := &Adherence{}
+
+	// Deviation of every activity sample from the route
+	routeIndex := newEdgeIndex(routePath.pts, opts.Tolerance)
+	var section *OffCourseSection
+	for i, p := range track {
+		d := routeIndex.nearest(p)
+		a.MaxDeviation = math.Max(a.MaxDeviation, d)
+
+		if d <= opts.Tolerance {
+			section = nil
+			continue
+		}
+		if section == nil {
+			a.OffCourse = append(a.OffCourse, OffCourseSection{StartIndex: i, EndIndex: i})
+			section = &a.OffCourse[len(a.OffCourse)-1]
+		} else {
+			section.Distance += track[i-1].distance(p)
+			section.EndIndex = i
+		}
+		section.MaxDeviation = math.Max(section.MaxDeviation, d)
+	}
+
+	// Share of the route that has activity samples nearby
+	trackIndex := newEdgeIndex(track, opts.Tolerance)
+	covered, total := 0, 0
+	for along := 0.0; along <= routePath.length(); along += coverageStep {
+		total++
+		if trackIndex.nearest(routePath.at(along)) <= opts.Tolerance {
+			covered++
+		}
+	}
+	if total > 0 {
+		a.Coverage = float64(covered) / float64(total) * 100
+	}
+
+	if route != nil {
+		a.Checkpoints, a.SkippedWaypoints = timeWaypoints(route.Waypoints, routeSet, routePath, proj, track, t, opts.Tolerance)
+	}
+
+	return a, nil
+}
+
+// Returns the coordinates of the route, from its streams or its summary polyline.
+func routeGeometry(route *gostrava.RouteDetailed, routeSet *gostrava.StreamSet) ([]gostrava.LatLng, error) {
+	var points []gostrava.LatLng
+	if routeSet != nil && routeSet.LatLngStream != nil {
+		points = routeSet.LatLngStream.Data
+	} else if route != nil {
+		decoded, err := route.Map.Decode()
+		if err != nil {
+			return nil, err
+		}
+		points = decoded
+	}
+
+	if len(points) == 0 {
+		return nil, missingStream("route latlng")
+	}
+	return points, nil
+}
+
+// Times the waypoints in order of DistanceIntoRoute. Each one is located on the route from its
+// distance into it, or from its LatLng when it has none, and is passed at the closest approach of the
+// activity after the previous checkpoint.
+func timeWaypoints(waypoints []gostrava.Waypoint, routeSet *gostrava.StreamSet, routePath path, proj projection, track []point, t []int, tolerance float64) ([]Checkpoint, []gostrava.Waypoint) {
+	sorted := append([]gostrava.Waypoint(nil), waypoints...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].DistanceIntoRoute < sorted[j].DistanceIntoRoute })
+
+	checkpoints := []Checkpoint{}
+	skipped := []gostrava.Waypoint{}
+	from := 0
+	for _, w := range sorted {
+		target := routePath.at(pathDistance(routeSet, routePath, float64(w.DistanceIntoRoute)))
+		if w.DistanceIntoRoute == 0 && w.LatLng != (gostrava.LatLng{}) {
+			target = proj.point(w.LatLng)
+		}
+
+		i := closestApproach(track, target, from, tolerance)
+		if i < 0 {
+			skipped = append(skipped, w)
+			continue
+		}
+
+		checkpoints = append(checkpoints, Checkpoint{Waypoint: w, Index: i, ElapsedTime: t[i] - t[0]})
+		from = i
+	}
+
+	return checkpoints, skipped
+}
+
+// Converts a distance into the route, as measured by its DistanceStream, into a distance along the
+// route's path, so that both agree even when the path was simplified.
+func pathDistance(routeSet *gostrava.StreamSet, routePath path, distance float64) float64 {
+	if routeSet == nil || routeSet.DistanceStream == nil || len(routeSet.DistanceStream.Data) != len(routePath.cum) {
+		return distance
+	}
+
+	d := routeSet.DistanceStream.Data
+	i := sort.Search(len(d), func(i int) bool { return float64(d[i]) >= distance })
+	if i == 0 {
+		return 0
+	}
+	if i == len(d) {
+		return routePath.length()
+	}
+
+	f := (distance - float64(d[i-1])) / float64(d[i]-d[i-1])
+	return routePath.cum[i-1] + f*(routePath.cum[i]-routePath.cum[i-1])
+}
+
+// A grid of the edges of a polyline, to find the distance from a point to it without scanning every
+// edge. Coarser grids, each with cells twice as large as the one below, record which cells are
+// occupied, up to a grid of at most four cells, so that distant points are resolved in a few steps.
+type edgeIndex struct {
+	pts    []point
+	size   float64
+	cells  map[[2]int][]int  // The edges crossing each cell of the finest grid
+	levels []map[[2]int]bool // The occupied cells of each coarser grid, from the finest up
+}
+
+func newEdgeIndex(pts []point, cellSize float64) *edgeIndex {
+	idx := &edgeIndex{pts: pts, size: cellSize, cells: map[[2]int][]int{}}
+	for e := 0; e+1 < len(pts); e++ {
+		a, b := idx.cell(pts[e]), idx.cell(pts[e+1])
+		for x := min(a[0], b[0]); x <= max(a[0], b[0]); x++ {
+			for y := min(a[1], b[1]); y <= max(a[1], b[1]); y++ {
+				idx.cells[[2]int{x, y}] = append(idx.cells[[2]int{x, y}], e)
+			}
+		}
+	}
+
+	occupied := map[[2]int]bool{}
+	for c := range idx.cells {
+		occupied[c] = true
+	}
+	for len(occupied) > 4 {
+		parents := map[[2]int]bool{}
+		for c := range occupied {
+			parents[[2]int{c[0] >> 1, c[1] >> 1}] = true
+		}
+		idx.levels = append(idx.levels, parents)
+		occupied = parents
+	}
+	return idx
+}
+
+func (idx *edgeIndex) cell(p point) [2]int {
+	return [2]int{int(math.Floor(p.x / idx.size)), int(math.Floor(p.y / idx.size))}
+}
+
+// A cell of the edge index pending in a search, with its distance from the searched point.
+type indexCell struct {
+	dist  float64
+	level int // 0 for the finest grid, holding the edges
+	cell  [2]int
+}
+
+type indexCells []indexCell
+
+func (h indexCells) Len() int            { return len(h) }
+func (h indexCells) Less(i, j int) bool  { return h[i].dist < h[j].dist }
+func (h indexCells) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *indexCells) Push(x interface{}) { *h = append(*h, x.(indexCell)) }
+func (h *indexCells) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// Returns the distance from q to the polyline. Edges in the cells around q are checked first, which
+// is exact for distances up to the cell size. Farther points are searched outward, nearest cell first,
+// starting from the coarsest grid and splitting occupied cells down to the edges of the finest one,
+// until the nearest pending cell is farther than the closest edge found.
+func (idx *edgeIndex) nearest(q point) float64 {
+	if len(idx.pts) == 1 {
+		return q.distance(idx.pts[0])
+	}
+
+	best := math.Inf(1)
+	c := idx.cell(q)
+	for x := c[0] - 1; x <= c[0]+1; x++ {
+		for y := c[1] - 1; y <= c[1]+1; y++ {
+			for _, e := range idx.cells[[2]int{x, y}] {
+				d, _ := segmentDistance(q, idx.pts[e], idx.pts[e+1])
+				best = math.Min(best, d)
+			}
+		}
+	}
+	if best <= idx.size {
+		return best
+	}
+
+	// The distance from q to a cell of the given level
+	distance := func(level int, c [2]int) float64 {
+		size := idx.size * float64(int(1)<<level)
+		x0, y0 := float64(c[0])*size, float64(c[1])*size
+		dx := math.Max(0, math.Max(x0-q.x, q.x-x0-size))
+		dy := math.Max(0, math.Max(y0-q.y, q.y-y0-size))
+		return math.Hypot(dx, dy)
+	}
+
+	pending := &indexCells{}
+	top := len(idx.levels)
+	if top == 0 {
+		for c := range idx.cells {
+			heap.Push(pending, indexCell{distance(0, c), 0, c})
+		}
+	} else {
+		for c := range idx.levels[top-1] {
+			heap.Push(pending, indexCell{distance(top, c), top, c})
+		}
+	}
+
+	for pending.Len() > 0 {
+		c := heap.Pop(pending).(indexCell)
+		if c.dist >= best {
+			break
+		}
+
+		if c.level == 0 {
+			for _, e := range idx.cells[c.cell] {
+				d, _ := segmentDistance(q, idx.pts[e], idx.pts[e+1])
+				best = math.Min(best, d)
+			}
+			continue
+		}
+
+		for i := 0; i < 4; i++ {
+			child := [2]int{c.cell[0]<<1 + i&1, c.cell[1]<<1 + i>>1}
+			occupied := c.level == 1 && len(idx.cells[child]) > 0 || c.level > 1 && idx.levels[c.level-2][child]
+			if occupied {
+				heap.Push(pending, indexCell{distance(c.level-1, child), c.level - 1, child})
+			}
+		}
+	}
+	return best
+}
@@ -0,0 +1,175 @@
+package analysis
+
+import (
+	"github.com/guisaez/gostrava"
+)
+
+const (
+	defaultMatchTolerance = 30  // meters
+	matchLookahead        = 200 // meters
+	maxMatchDetour        = 2   // An effort may be at most this many times longer than the segment, plus the lookahead
+)
+
+type MatchOpts struct {
+	Tolerance float64 // Largest distance, in meters, between the activity track and the segment geometry. Defaults to 30
+}
+
+// Finds the efforts of a known segment in an activity track, without Strava's server-side matching.
+// The segment geometry is usually the LatLngStream returned by StreamsService.GetSegmentStreams; when
+// it is empty the segment's map polyline is decoded instead. A traversal must start near the start
+// of the segment, follow it in its direction within the tolerance and reach its end. Each match is
+// returned with its StartIndex, EndIndex, ElapsedTime and MovingTime in the activity's streams.
+func MatchSegment(segment *gostrava.SegmentDetailed, geometry []gostrava.LatLng, set *gostrava.StreamSet, opts MatchOpts) ([]gostrava.SegmentEffortDetailed, error) {
+	if segment == nil {
+		return nil, ErrNilSegment
+	}
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.LatLngStream == nil {
+		return nil, missingStream("latlng")
+	}
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = defaultMatchTolerance
+	}
+
+	if len(geometry) == 0 && segment.Map != nil {
+		decoded, err := segment.Map.Decode()
+		if err != nil {
+			return nil, err
+		}
+		geometry = decoded
+	}
+	if len(geometry) < 2 {
+		return nil, missingStream("segment latlng")
+	}
+
+	n := sampleCount(set, len(set.LatLngStream.Data))
+	if n < 2 {
+		return nil, ErrNoSamples
+	}
+
+	proj := newProjection(geometry[0])
+	seg := newPath(proj.points(geometry))
+	track := proj.points(set.LatLngStream.Data[:n])
+	t := sampleTimes(set, n)
+	moving := movingMask(set, n)
+	dist := sampleDistances(set)
+
+	efforts := []gostrava.SegmentEffortDetailed{}
+	for i := 0; i < n; i++ {
+		start := closestApproach(track, seg.pts[0], i, opts.Tolerance)
+		if start < 0 {
+			break // The track never comes near the start again
+		}
+
+		end, ok := followSegment(track, seg, start, opts.Tolerance)
+		if !ok {
+			i = start
+			continue
+		}
+
+		efforts = append(efforts, segmentEffort(segment, set, t, moving, dist, start, end))
+		i = end
+	}
+
+	return efforts, nil
+}
+
+// Returns the index of the point of the track closest to target within the first run of points,
+// from index from on, that lie within the tolerance of it. Returns -1 when there is none.
+func closestApproach(track []point, target point, from int, tolerance float64) int {
+	best := -1
+	for i := from; i < len(track); i++ {
+		d := track[i].distance(target)
+		if d > tolerance {
+			if best >= 0 {
+				break
+			}
+			continue
+		}
+		if best < 0 || d < track[best].distance(target) {
+			best = i
+		}
+	}
+	return best
+}
+
+// Follows the segment along the track from the start index. Every point must lie within the tolerance
+// of the segment and progress along it in its direction, without skipping ahead further than the
+// track itself moved. Returns the index of the closest approach to the end of the segment.
+func followSegment(track []point, seg path, start int, tolerance float64) (int, bool) {
+	end := seg.pts[len(seg.pts)-1]
+	length := seg.length()
+	maxTravel := length*maxMatchDetour + matchLookahead
+
+	progress, edge, travelled := 0.0, 0, 0.0
+	for j := start + 1; j < len(track); j++ {
+		step := track[j-1].distance(track[j])
+		travelled += step
+		if travelled > maxTravel {
+			return 0, false
+		}
+
+		// Only look at the part of the segment around the current progress, so loops and
+		// switchbacks can't make the track jump between distant parts of the segment
+		to := edge + 1
+		for to < len(seg.pts)-1 && seg.cum[to] < progress+step+matchLookahead {
+			to++
+		}
+		d, along, e := seg.nearest(track[j], edge-1, to)
+		if d > tolerance || along < progress-tolerance || along-progress > step+2*tolerance {
+			return 0, false
+		}
+
+		if along > progress {
+			progress, edge = along, e
+		}
+
+		if progress >= length-tolerance && track[j].distance(end) <= tolerance {
+			closest := j
+			for k := j + 1; k < len(track) && track[k].distance(end) <= tolerance; k++ {
+				if track[k].distance(end) < track[closest].distance(end) {
+					closest = k
+				}
+			}
+			return closest, true
+		}
+	}
+
+	return 0, false
+}
+
+func segmentEffort(segment *gostrava.SegmentDetailed, set *gostrava.StreamSet, t []int, moving []bool, dist []float64, start, end int) gostrava.SegmentEffortDetailed {
+	effort := gostrava.SegmentEffortDetailed{
+		Name:       &segment.Name,
+		Segment:    &segment.SegmentSummary,
+		StartIndex: &start,
+		EndIndex:   &end,
+	}
+
+	movingTime := movingTime(t, moving, start, end)
+	effort.MovingTime = &movingTime
+	effort.ElapsedTime = t[end] - t[start]
+	if end < len(dist) {
+		effort.Distance = float32(dist[end] - dist[start])
+	}
+
+	if s := set.WattsStream; s != nil && end < len(s.Data) {
+		avg, _ := intAverage(s.Data[start : end+1])
+		watts := float32(avg)
+		effort.AverageWatts = &watts
+	}
+	if s := set.HeartRateStream; s != nil && end < len(s.Data) {
+		_, max := intAverage(s.Data[start : end+1])
+		maxHeartRate := float32(max)
+		effort.MaxHeartRate = &maxHeartRate
+	}
+	if s := set.CadenceStream; s != nil && end < len(s.Data) {
+		avg, _ := intAverage(s.Data[start : end+1])
+		cadence := float32(avg)
+		effort.AvgCadence = &cadence
+	}
+
+	return effort
+}
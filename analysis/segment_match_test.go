@@ -0,0 +1,143 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/guisaez/gostrava"
+)
+
+// Returns a track through the waypoints with a sample every step degrees of longitude or latitude,
+// one second apart.
+func track(step float32, waypoints ...gostrava.LatLng) *gostrava.StreamSet {
+	points := []gostrava.LatLng{waypoints[0]}
+	for i := 1; i < len(waypoints); i++ {
+		a, b := waypoints[i-1], waypoints[i]
+		n := int(max(abs32(b[0]-a[0]), abs32(b[1]-a[1])) / step)
+		for j := 1; j <= n; j++ {
+			f := float32(j) / float32(n)
+			points = append(points, gostrava.LatLng{a[0] + (b[0]-a[0])*f, a[1] + (b[1]-a[1])*f})
+		}
+	}
+
+	t := make([]int, len(points))
+	for i := range t {
+		t[i] = i
+	}
+	return &gostrava.StreamSet{
+		LatLngStream: &gostrava.LatLngStream{Data: points},
+		TimeStream:   &gostrava.TimeStream{Data: t},
+	}
+}
+
+func abs32(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func TestMatchSegment(t *testing.T) {
+	const step = 0.0001 // About 8 meters of longitude, 11 meters of latitude
+
+	// A segment of about 800 meters heading east
+	segment := &gostrava.SegmentDetailed{}
+	segment.Name = "East"
+	geometry := []gostrava.LatLng{{45, 7}, {45, 7.005}, {45, 7.01}}
+
+	tests := []struct {
+		name    string
+		track   *gostrava.StreamSet
+		efforts int
+	}{
+		{
+			name:    "forward",
+			track:   track(step, gostrava.LatLng{45, 6.995}, gostrava.LatLng{45, 7.015}),
+			efforts: 1,
+		},
+		{
+			name:    "reverse",
+			track:   track(step, gostrava.LatLng{45, 7.015}, gostrava.LatLng{45, 6.995}),
+			efforts: 0,
+		},
+		{
+			name: "two laps",
+			track: track(step,
+				gostrava.LatLng{45, 6.995}, gostrava.LatLng{45, 7.015},
+				gostrava.LatLng{45.003, 7.015}, gostrava.LatLng{45.003, 6.995},
+				gostrava.LatLng{45, 6.995}, gostrava.LatLng{45, 7.015}),
+			efforts: 2,
+		},
+		{
+			name:    "out and back",
+			track:   track(step, gostrava.LatLng{45, 6.995}, gostrava.LatLng{45, 7.015}, gostrava.LatLng{45, 6.995}),
+			efforts: 1,
+		},
+		{
+			name:    "partial",
+			track:   track(step, gostrava.LatLng{45, 6.995}, gostrava.LatLng{45, 7.006}, gostrava.LatLng{45.003, 7.006}),
+			efforts: 0,
+		},
+		{
+			name:    "parallel road beyond the tolerance",
+			track:   track(step, gostrava.LatLng{45.001, 6.995}, gostrava.LatLng{45.001, 7.015}),
+			efforts: 0,
+		},
+		{
+			name:    "parallel within the tolerance",
+			track:   track(step, gostrava.LatLng{45.0002, 6.995}, gostrava.LatLng{45.0002, 7.015}),
+			efforts: 1,
+		},
+		{
+			name: "detour off the segment",
+			track: track(step,
+				gostrava.LatLng{45, 6.995}, gostrava.LatLng{45, 7.004},
+				gostrava.LatLng{45.003, 7.004}, gostrava.LatLng{45.003, 7.006},
+				gostrava.LatLng{45, 7.006}, gostrava.LatLng{45, 7.015}),
+			efforts: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			efforts, err := MatchSegment(segment, geometry, tt.track, MatchOpts{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(efforts) != tt.efforts {
+				t.Fatalf("got %d efforts, want %d", len(efforts), tt.efforts)
+			}
+
+			points := tt.track.LatLngStream.Data
+			for _, e := range efforts {
+				start, end := points[*e.StartIndex], points[*e.EndIndex]
+				if d := start.Distance(geometry[0]); d > defaultMatchTolerance {
+					t.Errorf("effort starts %.0f m from the segment start", d)
+				}
+				if d := end.Distance(geometry[len(geometry)-1]); d > defaultMatchTolerance {
+					t.Errorf("effort ends %.0f m from the segment end", d)
+				}
+				if e.ElapsedTime != *e.EndIndex-*e.StartIndex {
+					t.Errorf("got elapsed time %d, want %d", e.ElapsedTime, *e.EndIndex-*e.StartIndex)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchSegmentErrors(t *testing.T) {
+	segment := &gostrava.SegmentDetailed{}
+	geometry := []gostrava.LatLng{{45, 7}, {45, 7.01}}
+
+	if _, err := MatchSegment(nil, geometry, track(0.0001, gostrava.LatLng{45, 7}, gostrava.LatLng{45, 7.01}), MatchOpts{}); err != ErrNilSegment {
+		t.Errorf("nil segment: got %v, want %v", err, ErrNilSegment)
+	}
+	if _, err := MatchSegment(segment, geometry, nil, MatchOpts{}); err != ErrNilStreamSet {
+		t.Errorf("nil set: got %v, want %v", err, ErrNilStreamSet)
+	}
+	if _, err := MatchSegment(segment, geometry, &gostrava.StreamSet{}, MatchOpts{}); err == nil {
+		t.Error("set without latlng: got no error")
+	}
+	if _, err := MatchSegment(segment, nil, track(0.0001, gostrava.LatLng{45, 7}, gostrava.LatLng{45, 7.01}), MatchOpts{}); err == nil {
+		t.Error("segment without geometry: got no error")
+	}
+}
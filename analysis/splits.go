@@ -0,0 +1,122 @@
+package analysis
+
+import (
+	"github.com/guisaez/gostrava"
+)
+
+// Common split distances, in meters.
+const (
+	Kilometer = 1000.0
+	Mile      = 1609.344
+	Lap400    = 400.0
+)
+
+// Generates splits every given number of meters from the DistanceStream of the set, such as every
+// Kilometer or Mile. The last split covers whatever distance is left.
+func SplitsByDistance(set *gostrava.StreamSet, every float64) ([]gostrava.Split, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.DistanceStream == nil {
+		return nil, missingStream("distance")
+	}
+	if every <= 0 {
+		return nil, ErrInvalidOpts
+	}
+
+	n := sampleCount(set, len(set.DistanceStream.Data))
+	if n == 0 {
+		return nil, ErrNoSamples
+	}
+
+	dist := set.DistanceStream.Data
+	return splits(set, n, func(i, start int) bool {
+		return float64(dist[i]-dist[0]) >= every*float64(int(float64(dist[start]-dist[0])/every)+1)
+	}), nil
+}
+
+// Generates splits every given number of seconds of elapsed time from the TimeStream of the set.
+// The last split covers whatever time is left.
+func SplitsByTime(set *gostrava.StreamSet, every int) ([]gostrava.Split, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.TimeStream == nil {
+		return nil, missingStream("time")
+	}
+	if every <= 0 {
+		return nil, ErrInvalidOpts
+	}
+
+	n := len(set.TimeStream.Data)
+	if n == 0 {
+		return nil, ErrNoSamples
+	}
+
+	t := set.TimeStream.Data
+	return splits(set, n, func(i, start int) bool {
+		return t[i]-t[0] >= every*((t[start]-t[0])/every+1)
+	}), nil
+}
+
+// Cuts the first n samples of the set into splits, closing the current split, which started at
+// sample start, at the first sample i for which boundary returns true.
+func splits(set *gostrava.StreamSet, n int, boundary func(i, start int) bool) []gostrava.Split {
+	t := sampleTimes(set, n)
+	moving := movingMask(set, n)
+	grades := sampleGrades(set, n)
+
+	resp := []gostrava.Split{}
+	start := 0
+	for i := 1; i < n; i++ {
+		if boundary(i, start) || i == n-1 {
+			resp = append(resp, split(set, t, moving, grades, start, i, len(resp)+1))
+			start = i
+		}
+	}
+
+	return resp
+}
+
+// Computes the split between the start and end samples. Each sample accounts for the time and
+// distance covered since the previous one.
+func split(set *gostrava.StreamSet, t []int, moving []bool, grades []float64, start, end, number int) gostrava.Split {
+	s := gostrava.Split{
+		Split:       number,
+		ElapsedTime: t[end] - t[start],
+		MovingTime:  movingTime(t, moving, start, end),
+	}
+
+	if set.AltitudeStream != nil && end < len(set.AltitudeStream.Data) {
+		s.ElevationDifference = set.AltitudeStream.Data[end] - set.AltitudeStream.Data[start]
+	}
+
+	var flat, heartRate float64
+	var heartRateTime int
+	for i := start + 1; i <= end; i++ {
+		dt := t[i] - t[i-1]
+
+		if set.DistanceStream != nil && i < len(set.DistanceStream.Data) {
+			d := float64(set.DistanceStream.Data[i] - set.DistanceStream.Data[i-1])
+			s.Distance += float32(d)
+			if moving[i] && grades != nil {
+				flat += d * Minetti(grades[i])
+			}
+		}
+
+		if set.HeartRateStream != nil && i < len(set.HeartRateStream.Data) && set.HeartRateStream.Data[i] > 0 {
+			heartRate += float64(set.HeartRateStream.Data[i] * dt)
+			heartRateTime += dt
+		}
+	}
+
+	if s.MovingTime > 0 {
+		s.AvgSpeed = s.Distance / float32(s.MovingTime)
+		s.AvgGradeAdjustedSpeed = float32(flat / float64(s.MovingTime))
+	}
+	if heartRateTime > 0 {
+		s.AvgHeartRate = float32(heartRate / float64(heartRateTime))
+	}
+
+	return s
+}
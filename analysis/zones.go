@@ -0,0 +1,166 @@
+package analysis
+
+import (
+	"math"
+
+	"github.com/guisaez/gostrava"
+)
+
+// Values of ActivityZone.Type
+const (
+	HeartRateZone = "heartrate"
+	PowerZone     = "power"
+)
+
+// Upper bounds of the Coggan power zones, as fractions of FTP.
+var cogganPowerBounds = []float64{0.55, 0.75, 0.90, 1.05, 1.20, 1.50}
+
+// Upper bounds of the 5-zone heart rate model, as fractions of the maximum heart rate.
+var maxHeartRateBounds = []float64{0.60, 0.70, 0.80, 0.90}
+
+// Builds zones from a reference value, such as FTP or maximum heart rate, and the upper bound of
+// every zone but the last one as fractions of it. The first zone starts at zero and the last one
+// is open-ended, with a Max of -1 as returned by the Strava API.
+func ZonesFromPercentages(reference int, bounds ...float64) []gostrava.ZoneRange {
+	zones := make([]gostrava.ZoneRange, 0, len(bounds)+1)
+
+	min := 0
+	for _, b := range bounds {
+		max := int(math.Round(float64(reference) * b))
+		zones = append(zones, gostrava.ZoneRange{Min: min, Max: max})
+		min = max
+	}
+
+	return append(zones, gostrava.ZoneRange{Min: min, Max: -1})
+}
+
+// Returns the Coggan 7-zone power model for the given FTP.
+func CogganPowerZones(ftp int) gostrava.PowerZoneRanges {
+	return gostrava.PowerZoneRanges{Zones: ZonesFromPercentages(ftp, cogganPowerBounds...)}
+}
+
+// Returns the 5-zone heart rate model based on percentages of the given maximum heart rate.
+func MaxHeartRateZones(maxHeartRate int) gostrava.HeartRateZoneRanges {
+	return gostrava.HeartRateZoneRanges{
+		CustomZones: true,
+		Zones:       ZonesFromPercentages(maxHeartRate, maxHeartRateBounds...),
+	}
+}
+
+// Computes the time spent in each heart rate zone from the HeartrateStream and TimeStream of the set.
+func HeartRateTimeInZones(set *gostrava.StreamSet, zones gostrava.HeartRateZoneRanges) (*gostrava.ActivityZone, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.HeartRateStream == nil {
+		return nil, missingStream("heartrate")
+	}
+
+	zone, err := timeInZones(set, set.HeartRateStream.Data, zones.Zones)
+	if err != nil {
+		return nil, err
+	}
+
+	zoneType := HeartRateZone
+	zone.Type = &zoneType
+	zone.CustomZones = &zones.CustomZones
+
+	return zone, nil
+}
+
+// Computes the time spent in each power zone from the PowerStream and TimeStream of the set.
+func PowerTimeInZones(set *gostrava.StreamSet, zones gostrava.PowerZoneRanges) (*gostrava.ActivityZone, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.WattsStream == nil {
+		return nil, missingStream("watts")
+	}
+
+	zone, err := timeInZones(set, set.WattsStream.Data, zones.Zones)
+	if err != nil {
+		return nil, err
+	}
+
+	zoneType := PowerZone
+	zone.Type = &zoneType
+
+	return zone, nil
+}
+
+// Computes the time in zones for every stream of the set that has zones defined, in the same shape
+// returned by ActivityService.GetActivityZones. Zones are usually the ones returned by
+// CurrentAthleteService.GetZones. Returns ErrInvalidOpts when zones is nil.
+func ActivityZones(set *gostrava.StreamSet, zones *gostrava.Zones) ([]gostrava.ActivityZone, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if zones == nil {
+		return nil, ErrInvalidOpts
+	}
+
+	resp := []gostrava.ActivityZone{}
+
+	if set.HeartRateStream != nil && len(zones.HearRate.Zones) > 0 {
+		zone, err := HeartRateTimeInZones(set, zones.HearRate)
+		if err != nil {
+			return nil, err
+		}
+		resp = append(resp, *zone)
+	}
+
+	if set.WattsStream != nil && len(zones.Power.Zones) > 0 {
+		zone, err := PowerTimeInZones(set, zones.Power)
+		if err != nil {
+			return nil, err
+		}
+		resp = append(resp, *zone)
+	}
+
+	return resp, nil
+}
+
+// Distributes the moving time of the set over the given zones. Values below the first zone count
+// towards it, and values above a closed last zone count towards the last one.
+func timeInZones(set *gostrava.StreamSet, data []int, zones []gostrava.ZoneRange) (*gostrava.ActivityZone, error) {
+	n := sampleCount(set, len(data))
+	if n == 0 {
+		return nil, ErrNoSamples
+	}
+
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = float64(data[i])
+	}
+
+	s := perSecond(sampleTimes(set, n), values, movingMask(set, n), defaultMaxGap, false)
+
+	buckets := make([]gostrava.TimedZoneRange, len(zones))
+	for i, z := range zones {
+		buckets[i] = gostrava.TimedZoneRange{Min: z.Min, Max: z.Max}
+	}
+
+	if len(zones) > 0 {
+		for _, v := range s.values {
+			buckets[zoneIndex(zones, int(v))].Time++
+		}
+	}
+
+	sensorBased := true
+
+	return &gostrava.ActivityZone{
+		DistributionBuckets: buckets,
+		SensorBased:         &sensorBased,
+	}, nil
+}
+
+// Returns the index of the zone the value falls in. A zone includes its Min and excludes its Max,
+// and a Max of -1 leaves it open-ended.
+func zoneIndex(zones []gostrava.ZoneRange, v int) int {
+	for i, z := range zones {
+		if v < z.Max || z.Max < 0 {
+			return i
+		}
+	}
+	return len(zones) - 1
+}
@@ -0,0 +1,269 @@
+package export
+
+import (
+	"errors"
+	"time"
+
+	"github.com/guisaez/gostrava"
+)
+
+var (
+	ErrNilStreamSet  = errors.New("stream set is nil")
+	ErrMissingLatLng = errors.New("stream set has no latlng stream")
+)
+
+// Returns the activity's map as a LineString feature identified by the activity ID, with its main
+// figures as properties. Activities without a map, such as manual ones, have a null geometry. As in
+// WriteActivitiesCSV, start_date_local is the wall clock time and utc_offset its offset, when known.
+func ActivityFeature(a *gostrava.ActivitySummary) (*Feature, error) {
+	geometry, err := polylineGeometry(a.Map.SummaryPolyline)
+	if err != nil {
+		return nil, err
+	}
+	local, known := activityStart(a, nil)
+
+	f := NewFeature(geometry, map[string]interface{}{
+		"name":                 a.Name,
+		"sport_type":           a.SportType,
+		"start_date":           formatTime(a.StartDate.Time),
+		"start_date_local":     formatWallClock(local),
+		"utc_offset":           formatOffset(local, known),
+		"timezone":             a.Timezone,
+		"distance":             a.Distance,
+		"moving_time":          a.MovingTime,
+		"elapsed_time":         a.ElapsedTime,
+		"total_elevation_gain": a.TotalElevationGain,
+		"average_speed":        a.AvgSpeed,
+		"max_speed":            a.MaxSpeed,
+		"commute":              a.Commute,
+		"trainer":              a.Trainer,
+		"private":              a.Private,
+	})
+	f.ID = a.ID
+	if a.HasHeartRate {
+		f.Properties["average_heartrate"] = a.AvgHeartRate
+		f.Properties["max_heartrate"] = a.MaxHeartRate
+	}
+	if a.AvgWatts > 0 {
+		f.Properties["average_watts"] = a.AvgWatts
+	}
+
+	return f, nil
+}
+
+// Returns the activities as a feature collection, in order.
+func ActivitiesFeatureCollection(activities []gostrava.ActivitySummary) (*FeatureCollection, error) {
+	fc := NewFeatureCollection()
+	for i := range activities {
+		f, err := ActivityFeature(&activities[i])
+		if err != nil {
+			return nil, err
+		}
+		fc.Features = append(fc.Features, f)
+	}
+	return fc, nil
+}
+
+// Returns the route's map as a LineString feature identified by the route ID, with its main figures
+// as properties.
+func RouteFeature(r *gostrava.RouteSummary) (*Feature, error) {
+	geometry, err := polylineGeometry(r.Map.SummaryPolyline)
+	if err != nil {
+		return nil, err
+	}
+
+	f := NewFeature(geometry, map[string]interface{}{
+		"name":                  r.Name,
+		"description":           r.Description,
+		"type":                  r.Type,
+		"sub_type":              r.SubType,
+		"distance":              r.Distance,
+		"elevation_gain":        r.ElevationGain,
+		"estimated_moving_time": r.EstimatedMovingTime,
+		"private":               r.Private,
+		"starred":               r.Starred,
+	})
+	f.ID = r.ID
+	return f, nil
+}
+
+// Returns the segment's map as a LineString feature identified by the segment ID, falling back to a
+// line between its start and end when it has no map.
+func SegmentFeature(s *gostrava.SegmentDetailed) (*Feature, error) {
+	geometry := LineString([]gostrava.LatLng{s.StartLatLng, s.EndLatLng})
+	if s.Map != nil && s.Map.SummaryPolyline != "" {
+		var err error
+		if geometry, err = polylineGeometry(s.Map.SummaryPolyline); err != nil {
+			return nil, err
+		}
+	}
+
+	f := NewFeature(geometry, segmentProperties(s.Name, s.ActivityType, s.Distance, s.AvgGrade, s.ClimbCategory))
+	f.ID = s.ID
+	f.Properties["maximum_grade"] = s.MaxGrade
+	f.Properties["elevation_high"] = s.ElevationHigh
+	f.Properties["elevation_low"] = s.ElevationLow
+	f.Properties["total_elevation_gain"] = s.TotalElevationGain
+	f.Properties["effort_count"] = s.EffortCount
+	f.Properties["athlete_count"] = s.AthleteCount
+	return f, nil
+}
+
+// Returns the segments of an explorer response as a feature collection of LineStrings decoded from
+// their points. A nil response gives an empty collection, and nil segments are skipped.
+func ExplorerFeatureCollection(resp *gostrava.ExplorerResponse) (*FeatureCollection, error) {
+	fc := NewFeatureCollection()
+	if resp == nil {
+		return fc, nil
+	}
+	for _, s := range resp.Segments {
+		if s == nil {
+			continue
+		}
+
+		geometry := LineString([]gostrava.LatLng{s.StartLatLng, s.EndLatLng})
+		if s.Points != "" {
+			var err error
+			if geometry, err = polylineGeometry(s.Points); err != nil {
+				return nil, err
+			}
+		}
+
+		f := NewFeature(geometry, segmentProperties(s.Name, "", s.Distance, s.AvgGrade, s.ClimbCategory))
+		f.ID = s.ID
+		f.Properties["climb_category_desc"] = s.ClimbCategoryDesc
+		f.Properties["elev_difference"] = s.ElevationDiff
+		f.Properties["starred"] = s.Starred
+		fc.Features = append(fc.Features, f)
+	}
+	return fc, nil
+}
+
+func segmentProperties(name, activityType string, distance, avgGrade float32, climbCategory int8) map[string]interface{} {
+	properties := map[string]interface{}{
+		"name":           name,
+		"distance":       distance,
+		"average_grade":  avgGrade,
+		"climb_category": climbCategory,
+	}
+	if activityType != "" {
+		properties["activity_type"] = activityType
+	}
+	return properties
+}
+
+// Returns the LineString of an encoded polyline, a Point when it holds a single point, or nil when
+// it is empty.
+func polylineGeometry(encoded string) (*Geometry, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+
+	points, err := gostrava.DecodePolyline(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return lineGeometry(points), nil
+}
+
+// Returns the LineString through the points, a Point when there is only one as a LineString needs
+// two positions, or nil when there are none.
+func lineGeometry(points []gostrava.LatLng) *Geometry {
+	switch len(points) {
+	case 0:
+		return nil
+	case 1:
+		return Point(points[0])
+	}
+	return LineString(points)
+}
+
+// Returns the set's LatLngStream as a LineString feature, with altitude as the third coordinate when
+// available. The other streams are added as arrays in the coordinateProperties property, one value per
+// coordinate, keyed by their Strava stream type. When start is set, the absolute time of each
+// coordinate is also added as "times", as read by Leaflet and togeojson based tools. A single sample
+// gives a Point, and an empty stream a null geometry.
+func StreamSetFeature(set *gostrava.StreamSet, start time.Time) (*Feature, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.LatLngStream == nil {
+		return nil, ErrMissingLatLng
+	}
+
+	points := set.LatLngStream.Data
+	n := len(points)
+
+	coordinates := make([]Position, n)
+	for i, ll := range points {
+		coordinates[i] = NewPosition(ll)
+		if s := set.AltitudeStream; s != nil && len(s.Data) == n {
+			coordinates[i] = append(coordinates[i], float64(s.Data[i]))
+		}
+	}
+
+	props := map[string]interface{}{}
+	if s := set.TimeStream; s != nil {
+		addStream(props, "time", s.Data, n)
+	}
+	if s := set.DistanceStream; s != nil {
+		addStream(props, "distance", s.Data, n)
+	}
+	if s := set.SmoothVelocityStream; s != nil {
+		addStream(props, "velocity_smooth", s.Data, n)
+	}
+	if s := set.HeartRateStream; s != nil {
+		addStream(props, "heartrate", s.Data, n)
+	}
+	if s := set.CadenceStream; s != nil {
+		addStream(props, "cadence", s.Data, n)
+	}
+	if s := set.WattsStream; s != nil {
+		addStream(props, "watts", s.Data, n)
+	}
+	if s := set.TempStream; s != nil {
+		addStream(props, "temp", s.Data, n)
+	}
+	if s := set.MovingStream; s != nil {
+		addStream(props, "moving", s.Data, n)
+	}
+	if s := set.SmoothGradeStream; s != nil {
+		addStream(props, "grade_smooth", s.Data, n)
+	}
+
+	if s := set.TimeStream; s != nil && len(s.Data) == n && !start.IsZero() {
+		times := make([]string, n)
+		for i, t := range s.Data {
+			times[i] = start.Add(time.Duration(t) * time.Second).Format(time.RFC3339)
+		}
+		props["times"] = times
+	}
+
+	var geometry *Geometry
+	switch n {
+	case 0:
+	case 1:
+		geometry = &Geometry{Type: "Point", Coordinates: coordinates[0]}
+	default:
+		geometry = &Geometry{Type: "LineString", Coordinates: coordinates}
+	}
+
+	return NewFeature(geometry, map[string]interface{}{
+		"coordinateProperties": props,
+	}), nil
+}
+
+// Adds the data of a stream to the coordinate properties when it has one value per coordinate.
+func addStream[T any](props map[string]interface{}, key string, data []T, n int) {
+	if len(data) == n {
+		props[key] = data
+	}
+}
+
+// Returns the time in RFC 3339 format, or nil when it is not set.
+func formatTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,87 @@
+// Package export converts activities, routes, segments and streams into formats other tools can
+// read, such as GeoJSON.
+package export
+
+import (
+	"strconv"
+
+	"github.com/guisaez/gostrava"
+)
+
+// A GeoJSON position: longitude, latitude and, optionally, altitude.
+type Position []float64
+
+// Returns the GeoJSON position of a coordinate. Note that GeoJSON puts the longitude first.
+func NewPosition(ll gostrava.LatLng) Position {
+	return Position{roundCoordinate(ll[1]), roundCoordinate(ll[0])}
+}
+
+// Returns the coordinate as the shortest decimal that reads back as the same float32, so that 45.001
+// is not written as 45.000999450683594.
+func roundCoordinate(v float32) float64 {
+	f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
+	return f
+}
+
+type Geometry struct {
+	Type        string      `json:"type"`        // The type of geometry: Point, LineString, Polygon...
+	Coordinates interface{} `json:"coordinates"` // The positions of the geometry, nested as its type requires
+}
+
+// Returns a Point geometry.
+func Point(ll gostrava.LatLng) *Geometry {
+	return &Geometry{Type: "Point", Coordinates: NewPosition(ll)}
+}
+
+// Returns a LineString geometry.
+func LineString(points []gostrava.LatLng) *Geometry {
+	return &Geometry{Type: "LineString", Coordinates: positions(points)}
+}
+
+// Returns a Polygon geometry from its outer ring followed by any holes. Rings are closed when needed.
+func Polygon(rings ...[]gostrava.LatLng) *Geometry {
+	coordinates := make([][]Position, len(rings))
+	for i, ring := range rings {
+		coordinates[i] = positions(ring)
+		if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+			coordinates[i] = append(coordinates[i], NewPosition(ring[0]))
+		}
+	}
+	return &Geometry{Type: "Polygon", Coordinates: coordinates}
+}
+
+func positions(points []gostrava.LatLng) []Position {
+	p := make([]Position, len(points))
+	for i, ll := range points {
+		p[i] = NewPosition(ll)
+	}
+	return p
+}
+
+type Feature struct {
+	Type       string                 `json:"type"`         // Always "Feature"
+	ID         interface{}            `json:"id,omitempty"` // The identifier of the feature, such as an activity ID
+	Geometry   *Geometry              `json:"geometry"`     // The geometry of the feature, null when it has none
+	Properties map[string]interface{} `json:"properties"`   // The properties of the feature
+}
+
+// Returns a feature with the given geometry and properties.
+func NewFeature(geometry *Geometry, properties map[string]interface{}) *Feature {
+	if properties == nil {
+		properties = map[string]interface{}{}
+	}
+	return &Feature{Type: "Feature", Geometry: geometry, Properties: properties}
+}
+
+type FeatureCollection struct {
+	Type     string     `json:"type"`     // Always "FeatureCollection"
+	Features []*Feature `json:"features"` // The features of the collection
+}
+
+// Returns a feature collection of the given features.
+func NewFeatureCollection(features ...*Feature) *FeatureCollection {
+	if features == nil {
+		features = []*Feature{}
+	}
+	return &FeatureCollection{Type: "FeatureCollection", Features: features}
+}
@@ -0,0 +1,323 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guisaez/gostrava"
+)
+
+// A track to write to KML, with the placemarks that go along with it.
+type KMLTrack struct {
+	Name      string                           // The name of the track
+	SportType gostrava.SportType               // The sport of the track, which picks its colour
+	Points    []gostrava.LatLng                // The coordinates of the track
+	Altitude  []float32                        // The altitude of each point, in meters, if known
+	Times     []time.Time                      // The time of each point, if known. Tracks with times are written as gx:Track
+	Waypoints []gostrava.Waypoint              // Waypoints to mark, such as those of a route
+	Efforts   []gostrava.SegmentEffortDetailed // Segment efforts to mark, located by their StartIndex and EndIndex in Points
+}
+
+// Returns the track of an activity's streams. The times of the points are computed from start, usually
+// the activity's StartDate, and the TimeStream; they are left out when start is not set.
+func KMLTrackFromStreams(name string, sport gostrava.SportType, set *gostrava.StreamSet, start time.Time) (*KMLTrack, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.LatLngStream == nil {
+		return nil, ErrMissingLatLng
+	}
+
+	track := &KMLTrack{Name: name, SportType: sport, Points: set.LatLngStream.Data}
+	n := len(track.Points)
+	if s := set.AltitudeStream; s != nil && len(s.Data) == n {
+		track.Altitude = s.Data
+	}
+	if s := set.TimeStream; s != nil && len(s.Data) == n && !start.IsZero() {
+		track.Times = make([]time.Time, n)
+		for i, t := range s.Data {
+			track.Times[i] = start.Add(time.Duration(t) * time.Second)
+		}
+	}
+
+	return track, nil
+}
+
+// Returns the track of an activity from its summary polyline.
+func KMLTrackFromActivity(a *gostrava.ActivitySummary) (*KMLTrack, error) {
+	points, err := a.Map.Decode()
+	if err != nil {
+		return nil, err
+	}
+	return &KMLTrack{Name: a.Name, SportType: a.SportType, Points: points}, nil
+}
+
+// Returns the track of a route with its waypoints, from its streams when routeSet is not nil, as
+// returned by StreamsService.GetRouteStreams and converted with gostrava.NewStreamSet, or from its
+// summary polyline otherwise.
+func KMLTrackFromRoute(r *gostrava.RouteDetailed, routeSet *gostrava.StreamSet) (*KMLTrack, error) {
+	sport := gostrava.RideSport
+	if r.Type == gostrava.RunRoute {
+		sport = gostrava.RunSport
+	}
+
+	var track *KMLTrack
+	if routeSet != nil {
+		var err error
+		if track, err = KMLTrackFromStreams(r.Name, sport, routeSet, time.Time{}); err != nil {
+			return nil, err
+		}
+	} else {
+		points, err := r.Map.Decode()
+		if err != nil {
+			return nil, err
+		}
+		track = &KMLTrack{Name: r.Name, SportType: sport, Points: points}
+	}
+
+	track.Waypoints = r.Waypoints
+	return track, nil
+}
+
+// Line colours of the sport families.
+var (
+	rideColor   = color.RGBA{R: 0xfc, G: 0x4c, B: 0x02, A: 0xff}
+	footColor   = color.RGBA{R: 0xd3, G: 0x2f, B: 0x2f, A: 0xff}
+	waterColor  = color.RGBA{R: 0x1e, G: 0x88, B: 0xe5, A: 0xff}
+	winterColor = color.RGBA{R: 0x00, G: 0xac, B: 0xc1, A: 0xff}
+	otherColor  = color.RGBA{R: 0x8e, G: 0x24, B: 0xaa, A: 0xff}
+	effortColor = color.RGBA{R: 0xff, G: 0xd6, B: 0x00, A: 0xff}
+)
+
+// Returns the line colour of a sport.
+func sportColor(sport gostrava.SportType) color.RGBA {
+	switch sport {
+	case gostrava.RideSport, gostrava.VirtualRideSport, gostrava.EBikeRideSport, gostrava.GravelRideSport,
+		gostrava.MountainBikeRideSport, gostrava.EMountainBikeRideSport, gostrava.HandcycleSport, gostrava.VelomobileSport:
+		return rideColor
+	case gostrava.RunSport, gostrava.TrailRunSport, gostrava.VirtualRunSport, gostrava.WalkSportType,
+		gostrava.HikeSport, gostrava.WheelchairSport:
+		return footColor
+	case gostrava.SwimSport, gostrava.RowingSport, gostrava.KayakingSport, gostrava.CanoeingSport,
+		gostrava.StandUpPaddlingSport, gostrava.SurfingSport, gostrava.SailSport, gostrava.KitesurfSport, gostrava.WindsurfSport:
+		return waterColor
+	case gostrava.AlpineSkiSport, gostrava.BackcountrySkiSport, gostrava.NordicSkiSport, gostrava.SnowboardSport,
+		gostrava.SnowshoeSport, gostrava.IceSkateSport:
+		return winterColor
+	}
+	return otherColor
+}
+
+// Returns a colour in KML's aabbggrr notation.
+func kmlColor(c color.RGBA) string {
+	return fmt.Sprintf("%02x%02x%02x%02x", c.A, c.B, c.G, c.R)
+}
+
+type kmlRoot struct {
+	XMLName  xml.Name    `xml:"kml"`
+	XMLNS    string      `xml:"xmlns,attr"`
+	GX       string      `xml:"xmlns:gx,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name    string      `xml:"name,omitempty"`
+	Styles  []kmlStyle  `xml:"Style"`
+	Folders []kmlFolder `xml:"Folder"`
+}
+
+type kmlStyle struct {
+	ID        string        `xml:"id,attr"`
+	LineStyle *kmlLineStyle `xml:"LineStyle,omitempty"`
+	IconStyle *kmlIconStyle `xml:"IconStyle,omitempty"`
+}
+
+type kmlLineStyle struct {
+	Color string  `xml:"color"`
+	Width float64 `xml:"width"`
+}
+
+type kmlIconStyle struct {
+	Color string  `xml:"color"`
+	Scale float64 `xml:"scale"`
+	Href  string  `xml:"Icon>href"`
+}
+
+type kmlFolder struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name        string         `xml:"name,omitempty"`
+	Description string         `xml:"description,omitempty"`
+	StyleURL    string         `xml:"styleUrl,omitempty"`
+	Point       *kmlPoint      `xml:"Point,omitempty"`
+	LineString  *kmlLineString `xml:"LineString,omitempty"`
+	Track       *kmlGXTrack    `xml:"gx:Track,omitempty"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlLineString struct {
+	Tessellate   int    `xml:"tessellate"`
+	AltitudeMode string `xml:"altitudeMode"`
+	Coordinates  string `xml:"coordinates"`
+}
+
+type kmlGXTrack struct {
+	AltitudeMode string   `xml:"altitudeMode"`
+	When         []string `xml:"when"`
+	Coords       []string `xml:"gx:coord"`
+}
+
+const waypointIcon = "http://maps.google.com/mapfiles/kml/paddle/wht-blank.png"
+
+// Writes the tracks as a KML document, one folder per track holding the track itself, its waypoints
+// and its segment efforts. Tracks with times are written as gx:Track so that Google Earth can play
+// them back; tracks with altitude are drawn at their absolute altitude.
+func WriteKML(w io.Writer, tracks ...*KMLTrack) error {
+	root := kmlRoot{
+		XMLNS: "http://www.opengis.net/kml/2.2",
+		GX:    "http://www.google.com/kml/ext/2.2",
+	}
+	if len(tracks) == 1 {
+		root.Document.Name = tracks[0].Name
+	}
+
+	root.Document.Styles = []kmlStyle{
+		{ID: "waypoint", IconStyle: &kmlIconStyle{Color: kmlColor(waterColor), Scale: 1, Href: waypointIcon}},
+		{ID: "effort", LineStyle: &kmlLineStyle{Color: kmlColor(effortColor), Width: 6}},
+	}
+	styled := map[string]bool{}
+
+	for _, t := range tracks {
+		style := "sport-" + string(t.SportType)
+		if t.SportType == "" {
+			style = "sport"
+		}
+		if !styled[style] {
+			styled[style] = true
+			root.Document.Styles = append(root.Document.Styles, kmlStyle{
+				ID:        style,
+				LineStyle: &kmlLineStyle{Color: kmlColor(sportColor(t.SportType)), Width: 4},
+			})
+		}
+
+		folder := kmlFolder{Name: t.Name}
+		folder.Placemarks = append(folder.Placemarks, trackPlacemark(t, style))
+
+		for _, wp := range t.Waypoints {
+			if wp.LatLng == (gostrava.LatLng{}) {
+				continue
+			}
+			folder.Placemarks = append(folder.Placemarks, kmlPlacemark{
+				Name:        wp.Title,
+				Description: wp.Description,
+				StyleURL:    "#waypoint",
+				Point:       &kmlPoint{Coordinates: kmlCoordinate(wp.LatLng, nil, 0, ",")},
+			})
+		}
+
+		for _, e := range t.Efforts {
+			if e.StartIndex == nil || e.EndIndex == nil || *e.StartIndex < 0 || *e.EndIndex >= len(t.Points) || *e.StartIndex > *e.EndIndex {
+				continue
+			}
+			placemark := kmlPlacemark{
+				Description: fmt.Sprintf("%.2f km in %s", e.Distance/1000, formatElapsed(e.ElapsedTime)),
+				StyleURL:    "#effort",
+				LineString:  lineString(t, *e.StartIndex, *e.EndIndex+1),
+			}
+			if e.Name != nil {
+				placemark.Name = *e.Name
+			}
+			folder.Placemarks = append(folder.Placemarks, placemark)
+		}
+
+		root.Document.Folders = append(root.Document.Folders, folder)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Writes the tracks as a KMZ archive, a zipped KML document.
+func WriteKMZ(w io.Writer, tracks ...*KMLTrack) error {
+	z := zip.NewWriter(w)
+	f, err := z.Create("doc.kml")
+	if err != nil {
+		return err
+	}
+	if err := WriteKML(f, tracks...); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+func trackPlacemark(t *KMLTrack, style string) kmlPlacemark {
+	placemark := kmlPlacemark{Name: t.Name, StyleURL: "#" + style}
+	if len(t.Times) != len(t.Points) || len(t.Points) == 0 {
+		placemark.LineString = lineString(t, 0, len(t.Points))
+		return placemark
+	}
+
+	track := &kmlGXTrack{AltitudeMode: altitudeMode(t)}
+	for i, ll := range t.Points {
+		track.When = append(track.When, t.Times[i].UTC().Format(time.RFC3339))
+		track.Coords = append(track.Coords, kmlCoordinate(ll, t.Altitude, i, " "))
+	}
+	placemark.Track = track
+	return placemark
+}
+
+// Returns the points [from, to) of the track as a LineString.
+func lineString(t *KMLTrack, from, to int) *kmlLineString {
+	coordinates := make([]string, 0, to-from)
+	for i := from; i < to; i++ {
+		coordinates = append(coordinates, kmlCoordinate(t.Points[i], t.Altitude, i, ","))
+	}
+	return &kmlLineString{Tessellate: 1, AltitudeMode: altitudeMode(t), Coordinates: strings.Join(coordinates, " ")}
+}
+
+func altitudeMode(t *KMLTrack) string {
+	if len(t.Altitude) == len(t.Points) && len(t.Points) > 0 {
+		return "absolute"
+	}
+	return "clampToGround"
+}
+
+// Returns a KML coordinate, longitude first, with the altitude of sample i when known.
+func kmlCoordinate(ll gostrava.LatLng, altitude []float32, i int, sep string) string {
+	c := formatFloat(ll[1]) + sep + formatFloat(ll[0])
+	if i < len(altitude) {
+		c += sep + formatFloat(altitude[i])
+	}
+	return c
+}
+
+func formatFloat(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', -1, 32)
+}
+
+func formatElapsed(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
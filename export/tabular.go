@@ -0,0 +1,355 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guisaez/gostrava"
+)
+
+const (
+	metersPerMile = 1609.344
+	feetPerMeter  = 3.28084
+)
+
+type TableOpts struct {
+	Units    string         // The unit system, as AthleteDetailed.MeasurementPreference: "meters" (default) or "feet"
+	Location *time.Location // The time zone of local times and their UTC offset. Defaults to the activity's Timezone
+}
+
+// The units of a table: the suffixes of the column names and the factors from Strava's units.
+type tableUnits struct {
+	distance, altitude, speed                string
+	distanceScale, altitudeScale, speedScale float64
+}
+
+func (o TableOpts) units() tableUnits {
+	if o.Units == "feet" {
+		return tableUnits{"mi", "ft", "mph", 1 / metersPerMile, feetPerMeter, 3600 / metersPerMile}
+	}
+	return tableUnits{"km", "m", "kmh", 1.0 / 1000, 1, 3.6}
+}
+
+// A column of a table, with the value of each row, nil when missing.
+type column struct {
+	name  string
+	value func(i int) interface{}
+}
+
+// Returns the columns of the available streams and the number of rows, the length of the longest
+// stream. Columns come in a fixed order: time_s, lat, lng, distance, altitude, speed, heartrate_bpm,
+// cadence_rpm, watts, temp_c, moving, grade_pct. Distance, altitude and speed are named after their
+// unit: distance_km, altitude_m and speed_kmh, or distance_mi, altitude_ft and speed_mph.
+func streamColumns(set *gostrava.StreamSet, u tableUnits) ([]column, int) {
+	columns := []column{}
+	rows := 0
+	add := func(name string, n int, value func(i int) interface{}) {
+		rows = max(rows, n)
+		columns = append(columns, column{name: name, value: func(i int) interface{} {
+			if i >= n {
+				return nil
+			}
+			return value(i)
+		}})
+	}
+
+	if s := set.TimeStream; s != nil {
+		add("time_s", len(s.Data), func(i int) interface{} { return s.Data[i] })
+	}
+	if s := set.LatLngStream; s != nil {
+		add("lat", len(s.Data), func(i int) interface{} { return roundCoordinate(s.Data[i][0]) })
+		add("lng", len(s.Data), func(i int) interface{} { return roundCoordinate(s.Data[i][1]) })
+	}
+	if s := set.DistanceStream; s != nil {
+		add("distance_"+u.distance, len(s.Data), func(i int) interface{} { return round(float64(s.Data[i])*u.distanceScale, 5) })
+	}
+	if s := set.AltitudeStream; s != nil {
+		add("altitude_"+u.altitude, len(s.Data), func(i int) interface{} { return round(float64(s.Data[i])*u.altitudeScale, 2) })
+	}
+	if s := set.SmoothVelocityStream; s != nil {
+		add("speed_"+u.speed, len(s.Data), func(i int) interface{} { return round(float64(s.Data[i])*u.speedScale, 2) })
+	}
+	if s := set.HeartRateStream; s != nil {
+		add("heartrate_bpm", len(s.Data), func(i int) interface{} { return s.Data[i] })
+	}
+	if s := set.CadenceStream; s != nil {
+		add("cadence_rpm", len(s.Data), func(i int) interface{} { return s.Data[i] })
+	}
+	if s := set.WattsStream; s != nil {
+		add("watts", len(s.Data), func(i int) interface{} { return s.Data[i] })
+	}
+	if s := set.TempStream; s != nil {
+		add("temp_c", len(s.Data), func(i int) interface{} { return s.Data[i] })
+	}
+	if s := set.MovingStream; s != nil {
+		add("moving", len(s.Data), func(i int) interface{} { return s.Data[i] })
+	}
+	if s := set.SmoothGradeStream; s != nil {
+		add("grade_pct", len(s.Data), func(i int) interface{} { return round(float64(s.Data[i]), 1) })
+	}
+
+	return columns, rows
+}
+
+// Writes the set as CSV with a header and one row per sample. See streamColumns for the columns;
+// only the available streams are included, and missing values are left empty.
+func WriteStreamsCSV(w io.Writer, set *gostrava.StreamSet, opts TableOpts) error {
+	if set == nil {
+		return ErrNilStreamSet
+	}
+	columns, rows := streamColumns(set, opts.units())
+	return writeCSV(w, columns, rows)
+}
+
+// Writes the set as JSON Lines, one object per sample keyed by the same names as WriteStreamsCSV.
+// Missing values are left out.
+func WriteStreamsJSONL(w io.Writer, set *gostrava.StreamSet, opts TableOpts) error {
+	if set == nil {
+		return ErrNilStreamSet
+	}
+	columns, rows := streamColumns(set, opts.units())
+
+	b := bufio.NewWriter(w)
+	enc := json.NewEncoder(b)
+	for i := 0; i < rows; i++ {
+		row := make(map[string]interface{}, len(columns))
+		for _, c := range columns {
+			if v := c.value(i); v != nil {
+				row[c.name] = v
+			}
+		}
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	return b.Flush()
+}
+
+// Writes the activities as CSV with a header and one row per activity. The columns are, in order:
+// id, name, sport_type, start_date (UTC), start_date_local (the wall clock time in the activity's
+// time zone, without an offset), utc_offset (such as "+01:00", empty when unknown), timezone,
+// distance_km, moving_time_s, elapsed_time_s, total_elevation_gain_m, average_speed_kmh,
+// max_speed_kmh, average_heartrate, max_heartrate, average_watts, kilojoules, commute, trainer,
+// private, gear_id. With feet units, distance, elevation and speed columns end in _mi, _ft and _mph.
+func WriteActivitiesCSV(w io.Writer, activities []gostrava.ActivitySummary, opts TableOpts) error {
+	u := opts.units()
+	a := func(i int) *gostrava.ActivitySummary { return &activities[i] }
+
+	columns := []column{
+		{"id", func(i int) interface{} { return a(i).ID }},
+		{"name", func(i int) interface{} { return a(i).Name }},
+		{"sport_type", func(i int) interface{} { return a(i).SportType }},
+		{"start_date", func(i int) interface{} { return formatTime(a(i).StartDate.Time.UTC()) }},
+		{"start_date_local", func(i int) interface{} {
+			t, _ := activityStart(a(i), opts.Location)
+			return formatWallClock(t)
+		}},
+		{"utc_offset", func(i int) interface{} { return formatOffset(activityStart(a(i), opts.Location)) }},
+		{"timezone", func(i int) interface{} { return a(i).Timezone }},
+		{"distance_" + u.distance, func(i int) interface{} { return round(float64(a(i).Distance)*u.distanceScale, 3) }},
+		{"moving_time_s", func(i int) interface{} { return a(i).MovingTime }},
+		{"elapsed_time_s", func(i int) interface{} { return a(i).ElapsedTime }},
+		{"total_elevation_gain_" + u.altitude, func(i int) interface{} { return round(float64(a(i).TotalElevationGain)*u.altitudeScale, 1) }},
+		{"average_speed_" + u.speed, func(i int) interface{} { return round(float64(a(i).AvgSpeed)*u.speedScale, 2) }},
+		{"max_speed_" + u.speed, func(i int) interface{} { return round(float64(a(i).MaxSpeed)*u.speedScale, 2) }},
+		{"average_heartrate", func(i int) interface{} { return optional(a(i).HasHeartRate, a(i).AvgHeartRate) }},
+		{"max_heartrate", func(i int) interface{} { return optional(a(i).HasHeartRate, a(i).MaxHeartRate) }},
+		{"average_watts", func(i int) interface{} { return optional(a(i).AvgWatts > 0, a(i).AvgWatts) }},
+		{"kilojoules", func(i int) interface{} { return optional(a(i).Kilojoules > 0, a(i).Kilojoules) }},
+		{"commute", func(i int) interface{} { return a(i).Commute }},
+		{"trainer", func(i int) interface{} { return a(i).Trainer }},
+		{"private", func(i int) interface{} { return a(i).Private }},
+		{"gear_id", func(i int) interface{} {
+			if g := a(i).GearID; g != nil {
+				return *g
+			}
+			return nil
+		}},
+	}
+
+	return writeCSV(w, columns, len(activities))
+}
+
+// Writes the segment efforts as CSV with a header and one row per effort. The columns are, in order:
+// id, activity_id, segment_id, segment_name, start_date (UTC), start_date_local, utc_offset,
+// elapsed_time_s, moving_time_s, distance_km (distance_mi with feet units), average_watts,
+// average_cadence, max_heartrate, pr_rank, kom_rank, start_index, end_index. Local times are wall
+// clock times in opts.Location when set, and as recorded by Strava otherwise, with their offset in
+// their own column as in WriteActivitiesCSV.
+func WriteSegmentEffortsCSV(w io.Writer, efforts []gostrava.SegmentEffortDetailed, opts TableOpts) error {
+	u := opts.units()
+	e := func(i int) *gostrava.SegmentEffortDetailed { return &efforts[i] }
+
+	columns := []column{
+		{"id", func(i int) interface{} { return e(i).ID }},
+		{"activity_id", func(i int) interface{} {
+			if e(i).Activity != nil && e(i).ActivityID == 0 {
+				return e(i).Activity.ID
+			}
+			return e(i).ActivityID
+		}},
+		{"segment_id", func(i int) interface{} {
+			if s := e(i).Segment; s != nil {
+				return s.ID
+			}
+			return nil
+		}},
+		{"segment_name", func(i int) interface{} {
+			if n := e(i).Name; n != nil {
+				return *n
+			}
+			if s := e(i).Segment; s != nil {
+				return s.Name
+			}
+			return nil
+		}},
+		{"start_date", func(i int) interface{} { return formatTime(e(i).StartDate.Time.UTC()) }},
+		{"start_date_local", func(i int) interface{} {
+			t, _ := localStart(e(i).StartDate.Time, e(i).StartDateLocal.Time, opts.Location)
+			return formatWallClock(t)
+		}},
+		{"utc_offset", func(i int) interface{} {
+			return formatOffset(localStart(e(i).StartDate.Time, e(i).StartDateLocal.Time, opts.Location))
+		}},
+		{"elapsed_time_s", func(i int) interface{} { return e(i).ElapsedTime }},
+		{"moving_time_s", func(i int) interface{} { return deref(e(i).MovingTime) }},
+		{"distance_" + u.distance, func(i int) interface{} { return round(float64(e(i).Distance)*u.distanceScale, 3) }},
+		{"average_watts", func(i int) interface{} { return deref(e(i).AverageWatts) }},
+		{"average_cadence", func(i int) interface{} { return deref(e(i).AvgCadence) }},
+		{"max_heartrate", func(i int) interface{} { return deref(e(i).MaxHeartRate) }},
+		{"pr_rank", func(i int) interface{} { return deref(e(i).PRRank) }},
+		{"kom_rank", func(i int) interface{} { return deref(e(i).KomRank) }},
+		{"start_index", func(i int) interface{} { return deref(e(i).StartIndex) }},
+		{"end_index", func(i int) interface{} { return deref(e(i).EndIndex) }},
+	}
+
+	return writeCSV(w, columns, len(efforts))
+}
+
+func writeCSV(w io.Writer, columns []column, rows int) error {
+	cw := csv.NewWriter(w)
+
+	record := make([]string, len(columns))
+	for j, c := range columns {
+		record[j] = c.name
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+
+	for i := 0; i < rows; i++ {
+		for j, c := range columns {
+			record[j] = formatCell(c.value(i))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case gostrava.SportType:
+		return string(v)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func round(v float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(v*scale) / scale
+}
+
+// Returns the value when ok, nil otherwise.
+func optional[T any](ok bool, v T) interface{} {
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// Returns the pointed value, nil when the pointer is nil.
+func deref[T any](p *T) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+// Returns the local start time of the activity, as localStart, in loc or the time zone named in the
+// activity's Timezone, such as "(GMT+01:00) Europe/Paris".
+func activityStart(a *gostrava.ActivitySummary, loc *time.Location) (time.Time, bool) {
+	if loc == nil {
+		loc = timezone(a.Timezone)
+	}
+	return localStart(a.StartDate.Time, a.StartDateLocal.Time, loc)
+}
+
+// Returns the local time of start in loc. Without loc, the offset is the difference between local,
+// which Strava labels as UTC, and start. Reports whether the offset is known; when it is not, local is
+// returned as is.
+func localStart(start, local time.Time, loc *time.Location) (time.Time, bool) {
+	switch {
+	case start.IsZero():
+		return local, false
+	case loc != nil:
+		return start.In(loc), true
+	case !local.IsZero():
+		offset := local.Sub(start)
+		return start.In(time.FixedZone("", int(offset.Seconds()))), true
+	}
+	return local, false
+}
+
+// Returns the UTC offset of a local time, such as "+01:00", or nil when it is not known.
+func formatOffset(t time.Time, known bool) interface{} {
+	if !known {
+		return nil
+	}
+	return t.Format("-07:00")
+}
+
+// Returns the location named by a Strava time zone, such as "(GMT+01:00) Europe/Paris", or nil.
+func timezone(tz string) *time.Location {
+	if i := strings.LastIndex(tz, ") "); i >= 0 {
+		tz = tz[i+2:]
+	}
+	if tz == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+// Returns the wall clock time of t in its own location, without an offset.
+func formatWallClock(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format("2006-01-02T15:04:05")
+}
@@ -0,0 +1,41 @@
+package gostrava
+
+import "math"
+
+// Mean radius of the Earth, in meters.
+const earthRadius = 6371008.8
+
+// Returns the great-circle distance, in meters, between two coordinates.
+func (l LatLng) Distance(o LatLng) float64 {
+	lat1, lat2 := radians(l[0]), radians(o[0])
+	dLat := lat2 - lat1
+	dLng := radians(o[1] - l[1])
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+func radians(deg float32) float64 {
+	return float64(deg) * math.Pi / 180
+}
+
+// Returns the smallest bounds containing all the points.
+func NewBounds(points ...LatLng) Bounds {
+	if len(points) == 0 {
+		return Bounds{}
+	}
+
+	b := Bounds{SWLat: points[0][0], SWLng: points[0][1], NELat: points[0][0], NELng: points[0][1]}
+	for _, p := range points[1:] {
+		b.SWLat = min(b.SWLat, p[0])
+		b.SWLng = min(b.SWLng, p[1])
+		b.NELat = max(b.NELat, p[0])
+		b.NELng = max(b.NELng, p[1])
+	}
+	return b
+}
+
+// Returns whether the point lies within the bounds.
+func (b Bounds) Contains(p LatLng) bool {
+	return p[0] >= b.SWLat && p[0] <= b.NELat && p[1] >= b.SWLng && p[1] <= b.NELng
+}
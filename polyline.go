@@ -1,5 +1,11 @@
 package gostrava
 
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
 type PolylineSummmary struct {
 	ID              string `json:"id"`
 	SummaryPolyline string `json:"summary_polyline"`
@@ -10,3 +16,81 @@ type PolylineDetailed struct {
 	PolylineSummmary
 	Polyline string `json:"polyline"`
 }
+
+// Returns the decoded coordinates of the summary polyline.
+func (p PolylineSummmary) Decode() ([]LatLng, error) {
+	return DecodePolyline(p.SummaryPolyline)
+}
+
+// Returns the decoded coordinates of the full resolution polyline, falling back to the summary
+// polyline when it is not available.
+func (p PolylineDetailed) Decode() ([]LatLng, error) {
+	if p.Polyline == "" {
+		return p.PolylineSummmary.Decode()
+	}
+	return DecodePolyline(p.Polyline)
+}
+
+// Decodes a polyline encoded with the Google Encoded Polyline Algorithm, as used by Strava maps.
+func DecodePolyline(encoded string) ([]LatLng, error) {
+	points := []LatLng{}
+
+	var lat, lng int
+	for i := 0; i < len(encoded); {
+		var deltas [2]int
+		for j := range deltas {
+			var result, shift int
+			for {
+				if i >= len(encoded) {
+					return nil, errors.New("invalid polyline")
+				}
+				b := int(encoded[i]) - 63
+				i++
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				deltas[j] = ^(result >> 1)
+			} else {
+				deltas[j] = result >> 1
+			}
+		}
+
+		lat += deltas[0]
+		lng += deltas[1]
+		points = append(points, LatLng{float32(float64(lat) / 1e5), float32(float64(lng) / 1e5)})
+	}
+
+	return points, nil
+}
+
+// Encodes coordinates with the Google Encoded Polyline Algorithm, the reverse of DecodePolyline.
+func EncodePolyline(points []LatLng) string {
+	var b strings.Builder
+
+	var prevLat, prevLng int
+	for _, p := range points {
+		lat := int(math.Round(float64(p[0]) * 1e5))
+		lng := int(math.Round(float64(p[1]) * 1e5))
+		encodePolylineValue(&b, lat-prevLat)
+		encodePolylineValue(&b, lng-prevLng)
+		prevLat, prevLng = lat, lng
+	}
+
+	return b.String()
+}
+
+func encodePolylineValue(b *strings.Builder, v int) {
+	v <<= 1
+	if v < 0 {
+		v = ^v
+	}
+	for v >= 0x20 {
+		b.WriteByte(byte((0x20 | (v & 0x1f)) + 63))
+		v >>= 5
+	}
+	b.WriteByte(byte(v + 63))
+}
@@ -0,0 +1,213 @@
+// Package privacy hides the parts of an activity close to places an athlete wants to keep private,
+// such as their home, before its data is published or exported, the way Strava privacy zones do.
+package privacy
+
+import (
+	"errors"
+
+	"github.com/guisaez/gostrava"
+)
+
+var ErrNilStreamSet = errors.New("stream set is nil")
+
+type Zone struct {
+	Center gostrava.LatLng // The center of the zone
+	Radius float64         // The radius of the zone, in meters
+}
+
+// Returns whether the coordinate lies within the zone.
+func (z Zone) Contains(ll gostrava.LatLng) bool {
+	return z.Radius > 0 && z.Center.Distance(ll) <= z.Radius
+}
+
+type Filter struct {
+	Zones     []Zone  // Points within any of these zones are hidden
+	TrimStart float64 // The distance, in meters, hidden from the start of every track
+	TrimEnd   float64 // The distance, in meters, hidden from the end of every track
+}
+
+// Returns whether the coordinate lies within any of the filter's zones.
+func (f *Filter) InZone(ll gostrava.LatLng) bool {
+	for _, z := range f.Zones {
+		if z.Contains(ll) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns whether each point of a track remains visible: it must lie outside every zone, and at
+// least TrimStart meters from the start and TrimEnd meters from the end of the track.
+func (f *Filter) Visible(track []gostrava.LatLng) []bool {
+	cum := make([]float64, len(track))
+	for i := 1; i < len(track); i++ {
+		cum[i] = cum[i-1] + track[i-1].Distance(track[i])
+	}
+
+	visible := make([]bool, len(track))
+	if len(track) == 0 {
+		return visible
+	}
+
+	total := cum[len(cum)-1]
+	for i, ll := range track {
+		visible[i] = cum[i] >= f.TrimStart && total-cum[i] >= f.TrimEnd && !f.InZone(ll)
+	}
+	return visible
+}
+
+// Returns the visible points of a track.
+func (f *Filter) Points(track []gostrava.LatLng) []gostrava.LatLng {
+	return keep(track, f.Visible(track))
+}
+
+// Returns a copy of the set with the hidden samples removed from every stream, so that all streams
+// stay in sync. Visibility is decided from the LatLngStream; sets without one are returned unchanged
+// as they carry no location. Samples keep their original time and distance values.
+func (f *Filter) StreamSet(set *gostrava.StreamSet) (*gostrava.StreamSet, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+
+	filtered := *set
+	if set.LatLngStream == nil {
+		return &filtered, nil
+	}
+	visible := f.Visible(set.LatLngStream.Data)
+
+	if s := set.AltitudeStream; s != nil {
+		filtered.AltitudeStream = &gostrava.AltitudeStream{Data: keep(s.Data, visible), Stream: s.Stream}
+	}
+	if s := set.CadenceStream; s != nil {
+		filtered.CadenceStream = &gostrava.CadenceStream{Data: keep(s.Data, visible), Stream: s.Stream}
+	}
+	if s := set.DistanceStream; s != nil {
+		filtered.DistanceStream = &gostrava.DistanceStream{Data: keep(s.Data, visible), Stream: s.Stream}
+	}
+	if s := set.HeartRateStream; s != nil {
+		filtered.HeartRateStream = &gostrava.HeartrateStream{Data: keep(s.Data, visible), Stream: s.Stream}
+	}
+	if s := set.LatLngStream; s != nil {
+		filtered.LatLngStream = &gostrava.LatLngStream{Data: keep(s.Data, visible), Stream: s.Stream}
+	}
+	if s := set.MovingStream; s != nil {
+		filtered.MovingStream = &gostrava.MovingStream{Data: keep(s.Data, visible), Stream: s.Stream}
+	}
+	if s := set.SmoothGradeStream; s != nil {
+		filtered.SmoothGradeStream = &gostrava.SmoothGradeStream{Data: keep(s.Data, visible), Stream: s.Stream}
+	}
+	if s := set.SmoothVelocityStream; s != nil {
+		filtered.SmoothVelocityStream = &gostrava.SmoothVelocityStream{Data: keep(s.Data, visible), Stream: s.Stream}
+	}
+	if s := set.TempStream; s != nil {
+		filtered.TempStream = &gostrava.TemperatureStream{Data: keep(s.Data, visible), Stream: s.Stream}
+	}
+	if s := set.TimeStream; s != nil {
+		filtered.TimeStream = &gostrava.TimeStream{Data: keep(s.Data, visible), Stream: s.Stream}
+	}
+	if s := set.WattsStream; s != nil {
+		filtered.WattsStream = &gostrava.PowerStream{Data: keep(s.Data, visible), Stream: s.Stream}
+	}
+
+	return &filtered, nil
+}
+
+// Returns the values whose sample is visible. Samples beyond the end of visible are dropped.
+func keep[T any](data []T, visible []bool) []T {
+	kept := make([]T, 0, len(data))
+	for i, v := range data {
+		if i < len(visible) && visible[i] {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// Returns the encoded polyline with its hidden points removed.
+func (f *Filter) Polyline(encoded string) (string, error) {
+	if encoded == "" {
+		return "", nil
+	}
+
+	points, err := gostrava.DecodePolyline(encoded)
+	if err != nil {
+		return "", err
+	}
+	return gostrava.EncodePolyline(f.Points(points)), nil
+}
+
+// Returns the map with the hidden points removed from both its full and summary polylines.
+func (f *Filter) Map(m gostrava.PolylineDetailed) (gostrava.PolylineDetailed, error) {
+	var err error
+	if m.Polyline, err = f.Polyline(m.Polyline); err != nil {
+		return m, err
+	}
+	if m.SummaryPolyline, err = f.Polyline(m.SummaryPolyline); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// Hides the private parts of the activity's map. StartLatLng and EndLatLng are moved to the first and
+// last visible points, or cleared when the whole map is hidden or when there is no map to trim.
+func (f *Filter) Activity(a *gostrava.ActivitySummary) error {
+	points, err := a.Map.Decode()
+	if err != nil {
+		return err
+	}
+
+	m, err := f.Map(gostrava.PolylineDetailed{PolylineSummmary: a.Map})
+	if err != nil {
+		return err
+	}
+	a.Map = m.PolylineSummmary
+
+	f.endpoints(a, points)
+	return nil
+}
+
+// Hides the private parts of the activity's maps, like Activity, using the full resolution polyline
+// for StartLatLng and EndLatLng when available.
+func (f *Filter) ActivityDetailed(a *gostrava.ActivityDetailed) error {
+	if err := f.Activity(&a.ActivitySummary); err != nil {
+		return err
+	}
+
+	points, err := a.Map.Decode()
+	if err != nil {
+		return err
+	}
+
+	if a.Map, err = f.Map(a.Map); err != nil {
+		return err
+	}
+
+	f.endpoints(&a.ActivitySummary, points)
+	return nil
+}
+
+// Moves the start and end of the activity to the first and last visible points of its track. Without
+// a track both are cleared when trimming is set, as no visible point can replace them, and otherwise
+// only when they lie within a zone.
+func (f *Filter) endpoints(a *gostrava.ActivitySummary, track []gostrava.LatLng) {
+	if len(track) == 0 {
+		if f.TrimStart > 0 || f.TrimEnd > 0 {
+			a.StartLatLng, a.EndLatLng = gostrava.LatLng{}, gostrava.LatLng{}
+			return
+		}
+		if f.InZone(a.StartLatLng) {
+			a.StartLatLng = gostrava.LatLng{}
+		}
+		if f.InZone(a.EndLatLng) {
+			a.EndLatLng = gostrava.LatLng{}
+		}
+		return
+	}
+
+	visible := f.Points(track)
+	if len(visible) == 0 {
+		a.StartLatLng, a.EndLatLng = gostrava.LatLng{}, gostrava.LatLng{}
+		return
+	}
+	a.StartLatLng, a.EndLatLng = visible[0], visible[len(visible)-1]
+}
@@ -0,0 +1,411 @@
+package privacy
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/guisaez/gostrava"
+)
+
+// The home of the athlete. Its coordinates must never appear in filtered output.
+var home = gostrava.LatLng{45.1234, 7.5678}
+
+// Returns a track of n points heading east from start, about 79 meters apart.
+func eastFrom(start gostrava.LatLng, n int) []gostrava.LatLng {
+	points := make([]gostrava.LatLng, n)
+	for i := range points {
+		points[i] = gostrava.LatLng{start[0], start[1] + float32(i)*0.001}
+	}
+	return points
+}
+
+func reversed(points []gostrava.LatLng) []gostrava.LatLng {
+	r := make([]gostrava.LatLng, len(points))
+	for i, p := range points {
+		r[len(points)-1-i] = p
+	}
+	return r
+}
+
+func degrees(v float32) string {
+	return fmt.Sprintf("%.4f", v)
+}
+
+func TestVisible(t *testing.T) {
+	track := eastFrom(home, 10) // 0 to about 710 meters
+
+	tests := []struct {
+		name    string
+		filter  Filter
+		visible string
+	}{
+		{name: "no filter", filter: Filter{}, visible: "1111111111"},
+		{name: "zone", filter: Filter{Zones: []Zone{{Center: home, Radius: 100}}}, visible: "0011111111"},
+		{name: "zone in the middle", filter: Filter{Zones: []Zone{{Center: track[5], Radius: 50}}}, visible: "1111101111"},
+		{name: "trim start", filter: Filter{TrimStart: 200}, visible: "0001111111"},
+		{name: "trim end", filter: Filter{TrimEnd: 200}, visible: "1111111000"},
+		{name: "trim both", filter: Filter{TrimStart: 200, TrimEnd: 200}, visible: "0001111000"},
+		{name: "trim everything", filter: Filter{TrimStart: 400, TrimEnd: 400}, visible: "0000000000"},
+		{name: "zone without radius", filter: Filter{Zones: []Zone{{Center: home}}}, visible: "1111111111"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			for _, v := range tt.filter.Visible(track) {
+				if v {
+					got += "1"
+				} else {
+					got += "0"
+				}
+			}
+			if got != tt.visible {
+				t.Errorf("got %s, want %s", got, tt.visible)
+			}
+		})
+	}
+}
+
+func TestStreamSet(t *testing.T) {
+	track := eastFrom(home, 10)
+	n := len(track)
+	times := make([]int, n)
+	watts := make([]int, n)
+	distances := make([]float32, n)
+	for i := range times {
+		times[i], watts[i], distances[i] = i, 100+i, float32(i)*79
+	}
+	set := &gostrava.StreamSet{
+		LatLngStream:   &gostrava.LatLngStream{Data: track},
+		TimeStream:     &gostrava.TimeStream{Data: times},
+		WattsStream:    &gostrava.PowerStream{Data: watts},
+		DistanceStream: &gostrava.DistanceStream{Data: distances},
+	}
+
+	f := Filter{Zones: []Zone{{Center: home, Radius: 100}}, TrimEnd: 200}
+	filtered, err := f.StreamSet(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := filtered.LatLngStream.Data; len(got) != 5 || got[0] != track[2] || got[4] != track[6] {
+		t.Errorf("got latlng %v, want points 2 to 6", got)
+	}
+	if got := filtered.TimeStream.Data; len(got) != 5 || got[0] != 2 || got[4] != 6 {
+		t.Errorf("got time %v, want 2 to 6", got)
+	}
+	if got := filtered.WattsStream.Data; len(got) != 5 || got[0] != 102 {
+		t.Errorf("got watts %v, want 102 to 106", got)
+	}
+	if got := filtered.DistanceStream.Data; len(got) != 5 || got[0] != 158 {
+		t.Errorf("got distance %v, want 158 to 474", got)
+	}
+	if len(set.LatLngStream.Data) != n {
+		t.Error("the original set was modified")
+	}
+
+	if _, err := f.StreamSet(nil); err != ErrNilStreamSet {
+		t.Errorf("nil set: got %v, want %v", err, ErrNilStreamSet)
+	}
+
+	noLocation := &gostrava.StreamSet{TimeStream: &gostrava.TimeStream{Data: times}}
+	if filtered, err := f.StreamSet(noLocation); err != nil || len(filtered.TimeStream.Data) != n {
+		t.Error("a set without latlng should be returned unchanged")
+	}
+}
+
+func TestActivityEndpoints(t *testing.T) {
+	track := eastFrom(home, 10)
+	end := track[len(track)-1]
+
+	tests := []struct {
+		name       string
+		filter     Filter
+		track      []gostrava.LatLng // The map of the activity, none when nil
+		start, end gostrava.LatLng   // The expected endpoints
+	}{
+		{name: "zone", filter: Filter{Zones: []Zone{{Center: home, Radius: 100}}}, track: track, start: track[2], end: end},
+		{name: "trim", filter: Filter{TrimStart: 200, TrimEnd: 200}, track: track, start: track[3], end: track[6]},
+		{name: "trim everything", filter: Filter{TrimStart: 1000}, track: track},
+		{name: "zone without map", filter: Filter{Zones: []Zone{{Center: home, Radius: 100}}}, end: end},
+		{name: "trim start without map", filter: Filter{TrimStart: 500}},
+		{name: "trim end without map", filter: Filter{TrimEnd: 500}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &gostrava.ActivitySummary{StartLatLng: home, EndLatLng: end}
+			if tt.track != nil {
+				a.Map.SummaryPolyline = gostrava.EncodePolyline(tt.track)
+			}
+
+			if err := tt.filter.Activity(a); err != nil {
+				t.Fatal(err)
+			}
+			if a.StartLatLng != tt.start || a.EndLatLng != tt.end {
+				t.Errorf("got %v to %v, want %v to %v", a.StartLatLng, a.EndLatLng, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+// Returns a GPX document with the waypoints and tracks, and the bounds of all their points in its metadata.
+func gpx(waypoints []gostrava.LatLng, tracks ...[]gostrava.LatLng) string {
+	all := append([]gostrava.LatLng{}, waypoints...)
+	for _, track := range tracks {
+		all = append(all, track...)
+	}
+	b := gostrava.NewBounds(all...)
+
+	var s strings.Builder
+	s.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	s.WriteString(`<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">` + "\n")
+	fmt.Fprintf(&s, "  <metadata>\n    <bounds minlat=%q minlon=%q maxlat=%q maxlon=%q/>\n  </metadata>\n",
+		degrees(b.SWLat), degrees(b.SWLng), degrees(b.NELat), degrees(b.NELng))
+	for _, p := range waypoints {
+		fmt.Fprintf(&s, "  <wpt lat=%q lon=%q><name>Stop</name></wpt>\n", degrees(p[0]), degrees(p[1]))
+	}
+	for i, track := range tracks {
+		fmt.Fprintf(&s, "  <trk>\n    <name>Track %d</name>\n    <trkseg>\n", i+1)
+		for _, p := range track {
+			fmt.Fprintf(&s, "      <trkpt lat=%q lon=%q><ele>100</ele></trkpt>\n", degrees(p[0]), degrees(p[1]))
+		}
+		s.WriteString("    </trkseg>\n  </trk>\n")
+	}
+	s.WriteString("</gpx>\n")
+	return s.String()
+}
+
+// Returns the lat and lon attributes of the trkpt elements of each trk of a GPX document.
+func gpxTracks(t *testing.T, data []byte) [][]string {
+	var doc struct {
+		Tracks []struct {
+			Points []struct {
+				Lat string `xml:"lat,attr"`
+				Lon string `xml:"lon,attr"`
+			} `xml:"trkseg>trkpt"`
+		} `xml:"trk"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid GPX: %v\n%s", err, data)
+	}
+
+	tracks := [][]string{}
+	for _, track := range doc.Tracks {
+		points := []string{}
+		for _, p := range track.Points {
+			points = append(points, p.Lat+","+p.Lon)
+		}
+		tracks = append(tracks, points)
+	}
+	return tracks
+}
+
+func TestGPX(t *testing.T) {
+	// An outing from home and the way back, recorded as two tracks
+	out := eastFrom(home, 10)
+	back := reversed(out)
+
+	tests := []struct {
+		name   string
+		filter Filter
+		tracks [][]string // The first and last visible point of each track
+	}{
+		{
+			name:   "zone",
+			filter: Filter{Zones: []Zone{{Center: home, Radius: 100}}},
+			tracks: [][]string{{"45.1234,7.5698", "45.1234,7.5768"}, {"45.1234,7.5768", "45.1234,7.5698"}},
+		},
+		{
+			name:   "trim start of every track",
+			filter: Filter{TrimStart: 200},
+			tracks: [][]string{{"45.1234,7.5708", "45.1234,7.5768"}, {"45.1234,7.5738", "45.1234,7.5678"}},
+		},
+		{
+			name:   "trim both ends of every track",
+			filter: Filter{TrimStart: 200, TrimEnd: 200},
+			tracks: [][]string{{"45.1234,7.5708", "45.1234,7.5738"}, {"45.1234,7.5738", "45.1234,7.5708"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered, err := tt.filter.GPX([]byte(gpx(nil, out, back)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tracks := gpxTracks(t, filtered)
+			if len(tracks) != len(tt.tracks) {
+				t.Fatalf("got %d tracks, want %d", len(tracks), len(tt.tracks))
+			}
+			for i, track := range tracks {
+				if len(track) == 0 {
+					t.Fatalf("track %d: no points left", i+1)
+				}
+				first, last := track[0], track[len(track)-1]
+				if first != tt.tracks[i][0] || last != tt.tracks[i][1] {
+					t.Errorf("track %d: got %s to %s, want %s to %s", i+1, first, last, tt.tracks[i][0], tt.tracks[i][1])
+				}
+			}
+		})
+	}
+}
+
+func TestGPXHidesHome(t *testing.T) {
+	track := eastFrom(home, 10)
+	filters := map[string]Filter{
+		"zone":       {Zones: []Zone{{Center: home, Radius: 100}}},
+		"trim start": {TrimStart: 100},
+	}
+
+	for name, f := range filters {
+		t.Run(name, func(t *testing.T) {
+			filtered, err := f.GPX([]byte(gpx(nil, track)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(filtered), "7.5678") {
+				t.Errorf("the filtered document still holds the home coordinate:\n%s", filtered)
+			}
+			if !strings.Contains(string(filtered), `<bounds minlat="45.1234" minlon="7.5698" maxlat="45.1234" maxlon="7.5768"/>`) {
+				t.Errorf("the bounds were not recomputed from the visible points:\n%s", filtered)
+			}
+		})
+	}
+
+	t.Run("everything hidden", func(t *testing.T) {
+		f := Filter{Zones: []Zone{{Center: home, Radius: 10000}}}
+		filtered, err := f.GPX([]byte(gpx(nil, track)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(filtered), "45.1234") || strings.Contains(string(filtered), "<bounds") {
+			t.Errorf("the filtered document still holds a location:\n%s", filtered)
+		}
+		gpxTracks(t, filtered)
+	})
+}
+
+func TestGPXWaypoints(t *testing.T) {
+	track := eastFrom(home, 10)
+	f := Filter{Zones: []Zone{{Center: home, Radius: 100}}, TrimEnd: 200}
+
+	// Waypoints are only hidden by zones: the one at the trimmed end of the track stays
+	filtered, err := f.GPX([]byte(gpx([]gostrava.LatLng{home, track[9]}, track)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Waypoints []struct {
+			Lon string `xml:"lon,attr"`
+		} `xml:"wpt"`
+	}
+	if err := xml.Unmarshal(filtered, &doc); err != nil {
+		t.Fatalf("invalid GPX: %v\n%s", err, filtered)
+	}
+	if len(doc.Waypoints) != 1 || doc.Waypoints[0].Lon != "7.5768" {
+		t.Errorf("got waypoints %v, want the one at 7.5768 only", doc.Waypoints)
+	}
+	if strings.Contains(string(filtered), "7.5678") {
+		t.Errorf("the filtered document still holds the home coordinate:\n%s", filtered)
+	}
+}
+
+// Returns a TCX document of a course along the track, with a lap between its ends and a course point
+// in its middle, and of an activity along the same track.
+func tcx(track []gostrava.LatLng) string {
+	position := func(tag string, p gostrava.LatLng) string {
+		return fmt.Sprintf("<%s><LatitudeDegrees>%s</LatitudeDegrees><LongitudeDegrees>%s</LongitudeDegrees></%s>",
+			tag, degrees(p[0]), degrees(p[1]), tag)
+	}
+	trackpoints := func() string {
+		var s strings.Builder
+		for i, p := range track {
+			fmt.Fprintf(&s, "          <Trackpoint>\n            <Time>2024-01-01T00:00:%02dZ</Time>\n            %s\n          </Trackpoint>\n", i, position("Position", p))
+		}
+		return s.String()
+	}
+
+	var s strings.Builder
+	s.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	s.WriteString(`<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">` + "\n")
+	s.WriteString("  <Courses>\n    <Course>\n      <Name>Loop</Name>\n      <Lap>\n")
+	fmt.Fprintf(&s, "        %s\n        %s\n", position("BeginPosition", track[0]), position("EndPosition", track[len(track)-1]))
+	s.WriteString("      </Lap>\n      <Track>\n")
+	s.WriteString(trackpoints())
+	s.WriteString("      </Track>\n")
+	fmt.Fprintf(&s, "      <CoursePoint>\n        <Name>Middle</Name>\n        %s\n      </CoursePoint>\n", position("Position", track[len(track)/2]))
+	s.WriteString("    </Course>\n  </Courses>\n")
+	s.WriteString("  <Activities>\n    <Activity Sport=\"Biking\">\n      <Lap StartTime=\"2024-01-01T00:00:00Z\">\n        <Track>\n")
+	s.WriteString(trackpoints())
+	s.WriteString("        </Track>\n      </Lap>\n    </Activity>\n  </Activities>\n</TrainingCenterDatabase>\n")
+	return s.String()
+}
+
+func TestTCX(t *testing.T) {
+	track := eastFrom(home, 10)
+	filters := map[string]Filter{
+		"zone":       {Zones: []Zone{{Center: home, Radius: 100}}},
+		"trim start": {TrimStart: 100},
+		"trim end":   {TrimEnd: 100},
+	}
+
+	for name, f := range filters {
+		t.Run(name, func(t *testing.T) {
+			filtered, err := f.TCX([]byte(tcx(track)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var doc struct {
+				Courses []struct {
+					Trackpoints []struct{} `xml:"Track>Trackpoint"`
+					Points      []struct{} `xml:"CoursePoint"`
+				} `xml:"Courses>Course"`
+				Activities []struct {
+					Trackpoints []struct{} `xml:"Lap>Track>Trackpoint"`
+				} `xml:"Activities>Activity"`
+			}
+			if err := xml.Unmarshal(filtered, &doc); err != nil {
+				t.Fatalf("invalid TCX: %v\n%s", err, filtered)
+			}
+			if len(doc.Courses) != 1 || len(doc.Activities) != 1 {
+				t.Fatalf("got %d courses and %d activities, want 1 of each", len(doc.Courses), len(doc.Activities))
+			}
+			if n := len(doc.Courses[0].Points); n != 1 {
+				t.Errorf("got %d course points, want 1", n)
+			}
+			if n := len(doc.Courses[0].Trackpoints); n != 8 {
+				t.Errorf("got %d course trackpoints, want 8", n)
+			}
+			if n := len(doc.Activities[0].Trackpoints); n != 8 {
+				t.Errorf("got %d activity trackpoints, want 8, the ends of each track being trimmed separately", n)
+			}
+
+			out := string(filtered)
+			if name != "trim end" && strings.Contains(out, "7.5678") {
+				t.Errorf("the filtered document still holds the home coordinate:\n%s", out)
+			}
+			if name == "trim end" && strings.Contains(out, "7.5768") {
+				t.Errorf("the filtered document still holds the trimmed end:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestTCXKeepsVisiblePositions(t *testing.T) {
+	track := eastFrom(home, 10)
+	f := Filter{Zones: []Zone{{Center: gostrava.LatLng{0, 0}, Radius: 100}}}
+
+	filtered, err := f.TCX([]byte(tcx(track)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(filtered) != tcx(track) {
+		t.Errorf("a document away from every zone was modified:\n%s", filtered)
+	}
+}
@@ -0,0 +1,339 @@
+package privacy
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/guisaez/gostrava"
+)
+
+// The largest distance, in meters, between a position outside point elements, such as the
+// BeginPosition of a TCX lap, and a visible point for it to be kept.
+const positionMatch = 5
+
+// The kinds of elements of a GPX or TCX document that carry a location.
+const (
+	pointElement    = iota // A point of a track or a waypoint, as listed by the document format
+	positionElement        // Any other element with a position, such as a TCX BeginPosition
+	boundsElement          // The bounds of a GPX document
+)
+
+// An element of a GPX or TCX document that carries a location.
+type xmlElement struct {
+	kind        int
+	start, end  int    // The byte range of the element
+	indent      int    // The start of the whitespace before the element, the start when there is none
+	name        string // The qualified name of the element, as written in the document
+	track       int    // The track element the point belongs to, -1 outside any
+	latlng      gostrava.LatLng
+	hasPosition bool
+}
+
+// The formats of the documents filtered by GPX and TCX.
+type xmlFormat struct {
+	points map[string]bool // The point elements, filtered as tracks when mapped to true and by zone only otherwise
+	tracks map[string]bool // The elements whose points form a track, trimmed at both ends
+	bounds string          // The element holding the bounds of the document, if any
+}
+
+var (
+	gpxFormat = xmlFormat{
+		points: map[string]bool{"trkpt": true, "rtept": true, "wpt": false},
+		tracks: map[string]bool{"trk": true, "rte": true},
+		bounds: "bounds",
+	}
+	tcxFormat = xmlFormat{
+		points: map[string]bool{"Trackpoint": true, "CoursePoint": false},
+		tracks: map[string]bool{"Activity": true, "Course": true},
+	}
+)
+
+// Removes the hidden points from a GPX document. The points of every trk and rte are filtered as a
+// track, while waypoints are only removed when they lie within a zone. The bounds of the metadata are
+// recomputed from the visible points, and any other element with lat and lon attributes is removed
+// unless it lies on a visible point. Everything else is copied untouched.
+func (f *Filter) GPX(data []byte) ([]byte, error) {
+	return f.filterXML(data, gpxFormat)
+}
+
+// Removes the hidden trackpoints from a TCX document. The trackpoints of every Activity and Course are
+// filtered as a track; those without a position keep the visibility of the previous positioned one.
+// Course points are only removed when they lie within a zone. Any other position, such as the
+// BeginPosition and EndPosition of laps, is removed unless it lies on a visible point.
+func (f *Filter) TCX(data []byte) ([]byte, error) {
+	return f.filterXML(data, tcxFormat)
+}
+
+// Scans the document for the elements that carry a location and returns a copy of it without the
+// hidden ones.
+func (f *Filter) filterXML(data []byte, format xmlFormat) ([]byte, error) {
+	elements, err := scanElements(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden, visible := f.hideElements(elements, format)
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	last := 0
+	for i, e := range elements {
+		if e.start < last {
+			continue // Within an element already removed
+		}
+		switch {
+		case e.kind == boundsElement && len(visible) > 0:
+			out.Write(data[last:e.start])
+			out.WriteString(boundsTag(e.name, gostrava.NewBounds(visible...)))
+			last = e.end
+		case e.kind == boundsElement, hidden[i]:
+			out.Write(data[last:e.indent])
+			last = e.end
+		}
+	}
+	out.Write(data[last:])
+
+	return out.Bytes(), nil
+}
+
+// Returns which elements are hidden, along with the positions of the visible points. Points are
+// decided first, then other positions from them.
+func (f *Filter) hideElements(elements []xmlElement, format xmlFormat) ([]bool, []gostrava.LatLng) {
+	hidden := make([]bool, len(elements))
+
+	// Points of the same element name within the same track element form a track
+	groups := map[string][]int{}
+	keys := []string{}
+	for i, e := range elements {
+		if e.kind != pointElement {
+			continue
+		}
+		key := e.name
+		if format.points[e.name] {
+			key = fmt.Sprintf("%s/%d", e.name, e.track)
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+	for _, key := range keys {
+		indices := groups[key]
+		f.hidePoints(elements, indices, format.points[elements[indices[0]].name], hidden)
+	}
+
+	visible := []gostrava.LatLng{}
+	for i, e := range elements {
+		if e.kind == pointElement && e.hasPosition && !hidden[i] {
+			visible = append(visible, e.latlng)
+		}
+	}
+
+	for i, e := range elements {
+		if e.kind != positionElement {
+			continue
+		}
+		hidden[i] = f.InZone(e.latlng)
+		if !hidden[i] {
+			hidden[i] = !near(e.latlng, visible, positionMatch)
+		}
+	}
+
+	return hidden, visible
+}
+
+// Returns whether the coordinate lies within distance meters of any of the points.
+func near(ll gostrava.LatLng, points []gostrava.LatLng, distance float64) bool {
+	for _, p := range points {
+		if ll.Distance(p) <= distance {
+			return true
+		}
+	}
+	return false
+}
+
+// Marks the hidden points among the given indices.
+func (f *Filter) hidePoints(elements []xmlElement, indices []int, track bool, hidden []bool) {
+	positioned := []gostrava.LatLng{}
+	for _, i := range indices {
+		if elements[i].hasPosition {
+			positioned = append(positioned, elements[i].latlng)
+		}
+	}
+	if len(positioned) == 0 {
+		return
+	}
+
+	var visible []bool
+	if track {
+		visible = f.Visible(positioned)
+	} else {
+		visible = make([]bool, len(positioned))
+		for j, ll := range positioned {
+			visible[j] = !f.InZone(ll)
+		}
+	}
+
+	// Points without a position follow the previous positioned point, or the first one
+	j := 0
+	for _, i := range indices {
+		if elements[i].hasPosition {
+			hidden[i] = !visible[j]
+			j++
+		} else {
+			hidden[i] = !visible[max(j-1, 0)]
+		}
+	}
+}
+
+// Returns a GPX bounds element.
+func boundsTag(name string, b gostrava.Bounds) string {
+	return fmt.Sprintf(`<%s minlat="%s" minlon="%s" maxlat="%s" maxlon="%s"/>`, name,
+		formatDegrees(b.SWLat), formatDegrees(b.SWLng), formatDegrees(b.NELat), formatDegrees(b.NELng))
+}
+
+func formatDegrees(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', -1, 32)
+}
+
+// An element open while scanning a document.
+type openElement struct {
+	xmlElement
+	local   string // The local name of the element
+	point   int    // The index of the point element among the scanned ones, -1 when it is not one
+	hasLat  bool
+	hasLng  bool
+	isTrack bool
+}
+
+// Returns the elements of the document that carry a location, in order: the point elements of the
+// format, the GPX bounds, and the other elements with a position outside points. Positions are taken
+// from lat and lon attributes (GPX) or LatitudeDegrees and LongitudeDegrees children (TCX).
+func scanElements(data []byte, format xmlFormat) ([]xmlElement, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	elements := []xmlElement{}
+	stack := []*openElement{}
+	tracks := 0
+	indent := -1 // The offset of the whitespace preceding the current token, if any
+
+	// Returns the innermost open point element, if any
+	inPoint := func() *openElement {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].point >= 0 {
+				return stack[i]
+			}
+		}
+		return nil
+	}
+
+	for {
+		offset := int(d.InputOffset())
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			e := &openElement{local: tok.Name.Local, point: -1, xmlElement: xmlElement{start: offset, indent: offset, name: tok.Name.Local, track: -1}}
+			if tok.Name.Space != "" {
+				e.name = tok.Name.Space + ":" + tok.Name.Local
+			}
+			if indent >= 0 {
+				e.indent = indent
+			}
+			if lat, ok := attrFloat(tok.Attr, "lat"); ok {
+				e.latlng[0], e.hasLat = lat, true
+			}
+			if lon, ok := attrFloat(tok.Attr, "lon"); ok {
+				e.latlng[1], e.hasLng = lon, true
+			}
+
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].isTrack {
+					e.track = stack[i].track
+					break
+				}
+			}
+			if format.tracks[tok.Name.Local] {
+				e.isTrack, e.track = true, tracks
+				tracks++
+			}
+
+			if _, ok := format.points[tok.Name.Local]; ok && inPoint() == nil {
+				e.kind, e.point = pointElement, len(elements)
+				e.name = tok.Name.Local
+				elements = append(elements, e.xmlElement)
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				break
+			}
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			e.end = int(d.InputOffset())
+			e.hasPosition = e.hasLat && e.hasLng
+
+			switch {
+			case e.point >= 0:
+				p := &elements[e.point]
+				p.end = e.end
+				if !p.hasPosition && e.hasPosition {
+					p.latlng, p.hasPosition = e.latlng, true
+				}
+			case inPoint() != nil:
+				// A position within a point, such as the Position of a TCX trackpoint, locates the point
+				if p := &elements[inPoint().point]; !p.hasPosition && e.hasPosition {
+					p.latlng, p.hasPosition = e.latlng, true
+				}
+			case format.bounds != "" && e.local == format.bounds:
+				e.kind = boundsElement
+				elements = append(elements, e.xmlElement)
+			case e.hasPosition:
+				e.kind = positionElement
+				elements = append(elements, e.xmlElement)
+			}
+		case xml.CharData:
+			if len(stack) >= 2 {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(string(tok)), 32); err == nil {
+					parent := stack[len(stack)-2]
+					switch stack[len(stack)-1].local {
+					case "LatitudeDegrees":
+						parent.latlng[0], parent.hasLat = float32(v), true
+					case "LongitudeDegrees":
+						parent.latlng[1], parent.hasLng = float32(v), true
+					}
+				}
+			}
+			if len(bytes.TrimSpace(tok)) == 0 {
+				indent = offset
+				continue
+			}
+		}
+		indent = -1
+	}
+
+	// Elements are recorded when they close, points when they open
+	sort.SliceStable(elements, func(i, j int) bool { return elements[i].start < elements[j].start })
+	return elements, nil
+}
+
+func attrFloat(attrs []xml.Attr, name string) (float32, bool) {
+	for _, a := range attrs {
+		if a.Name.Local == name {
+			v, err := strconv.ParseFloat(a.Value, 32)
+			return float32(v), err == nil
+		}
+	}
+	return 0, false
+}
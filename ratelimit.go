@@ -0,0 +1,105 @@
+package gostrava
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrRateLimitReached = errors.New("strava rate limit reached")
+
+// The rate limits of the application and their usage, as reported by the last response. Strava counts
+// requests over fixed 15 minute windows, starting on the hour, and over the UTC day.
+type RateLimit struct {
+	ShortTermLimit int       // The number of requests allowed every 15 minutes
+	ShortTermUsage int       // The number of requests made in the current 15 minute window
+	DailyLimit     int       // The number of requests allowed every day
+	DailyUsage     int       // The number of requests made today
+	Updated        time.Time // When the limits were reported, zero until a response carries them
+}
+
+// Returns whether the limits were reported.
+func (r RateLimit) Known() bool {
+	return !r.Updated.IsZero() && r.ShortTermLimit > 0
+}
+
+// Returns the number of requests left before either limit is reached, as of the last response. A
+// window that ended since then is counted as empty.
+func (r RateLimit) Remaining(now time.Time) int {
+	short, daily := r.ShortTermUsage, r.DailyUsage
+	if now.Sub(shortTermWindow(r.Updated)) >= 15*time.Minute {
+		short = 0
+	}
+	if !sameDay(now, r.Updated) {
+		short, daily = 0, 0
+	}
+	return max(min(r.ShortTermLimit-short, r.DailyLimit-daily), 0)
+}
+
+// Returns when the window that limits requests ends: the current 15 minute window, or the UTC day
+// when the daily limit is reached.
+func (r RateLimit) Reset() time.Time {
+	if r.DailyLimit > 0 && r.DailyUsage >= r.DailyLimit {
+		y, m, d := r.Updated.UTC().Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+	}
+	return shortTermWindow(r.Updated).Add(15 * time.Minute)
+}
+
+func shortTermWindow(t time.Time) time.Time {
+	return t.UTC().Truncate(15 * time.Minute)
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.UTC().Date()
+	by, bm, bd := b.UTC().Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// Returns the rate limits reported by the last response, if any.
+func (c *Client) RateLimit() RateLimit {
+	c.rateLimitMu.Lock()
+	defer c.rateLimitMu.Unlock()
+	return c.rateLimit
+}
+
+// Records the rate limits of a response, from its X-RateLimit-Limit and X-RateLimit-Usage headers,
+// each holding the 15 minute and daily figures separated by a comma.
+func (c *Client) updateRateLimit(header http.Header) {
+	shortLimit, dailyLimit, ok := parseRateLimitHeader(header.Get("X-RateLimit-Limit"))
+	if !ok {
+		return
+	}
+	shortUsage, dailyUsage, ok := parseRateLimitHeader(header.Get("X-RateLimit-Usage"))
+	if !ok {
+		return
+	}
+
+	c.rateLimitMu.Lock()
+	defer c.rateLimitMu.Unlock()
+	c.rateLimit = RateLimit{
+		ShortTermLimit: shortLimit,
+		ShortTermUsage: shortUsage,
+		DailyLimit:     dailyLimit,
+		DailyUsage:     dailyUsage,
+		Updated:        time.Now(),
+	}
+}
+
+func parseRateLimitHeader(value string) (short, daily int, ok bool) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	short, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, false
+	}
+	daily, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, false
+	}
+	return short, daily, true
+}
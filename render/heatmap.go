@@ -0,0 +1,336 @@
+package render
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/guisaez/gostrava"
+	"github.com/guisaez/gostrava/export"
+)
+
+const (
+	tileSize        = 256     // The size of slippy map tiles, in pixels
+	maxHeatmapZoom  = 22      // The deepest zoom level of a heatmap
+	maxHeatmapCells = 1 << 25 // The largest number of cells of a heatmap grid, 128 MB of counts
+)
+
+var ErrHeatmapTooLarge = errors.New("heatmap grid is too large, reduce its bounds or zoom")
+
+type HeatmapFilter struct {
+	SportTypes []gostrava.SportType // Only activities of these sport types. Defaults to all
+	From       time.Time            // Only activities started at or after this time, if set
+	Until      time.Time            // Only activities started before this time, if set
+	Commute    *bool                // Only commutes, or only non-commutes, if set
+}
+
+// Returns whether the activity passes the filter.
+func (f HeatmapFilter) Match(a *gostrava.ActivitySummary) bool {
+	if len(f.SportTypes) > 0 {
+		found := false
+		for _, t := range f.SportTypes {
+			found = found || t == a.SportType
+		}
+		if !found {
+			return false
+		}
+	}
+
+	start := a.StartDate.Time
+	if !f.From.IsZero() && start.Before(f.From) {
+		return false
+	}
+	if !f.Until.IsZero() && !start.Before(f.Until) {
+		return false
+	}
+
+	return f.Commute == nil || *f.Commute == a.Commute
+}
+
+// A density grid of the tracks of many activities. Its cells are the pixels of slippy map tiles at
+// the heatmap's zoom level, covering fixed bounds, so its memory does not grow with the number of
+// activities added to it.
+type Heatmap struct {
+	Zoom   int             // The zoom level of the grid
+	Bounds gostrava.Bounds // The area covered by the grid
+	grid
+}
+
+// A window of the global pixel grid of a zoom level, with a count in every cell.
+type grid struct {
+	x0, y0        int // The global pixel of the top left cell
+	width, height int
+	counts        []uint32
+}
+
+func (g *grid) at(x, y int) uint32 {
+	x, y = x-g.x0, y-g.y0
+	if x < 0 || y < 0 || x >= g.width || y >= g.height {
+		return 0
+	}
+	return g.counts[y*g.width+x]
+}
+
+// Returns the grid of the zoom level above, with every cell holding the largest of the four it covers.
+func (g *grid) halve() *grid {
+	h := &grid{x0: g.x0 >> 1, y0: g.y0 >> 1}
+	h.width = (g.x0+g.width-1)>>1 - h.x0 + 1
+	h.height = (g.y0+g.height-1)>>1 - h.y0 + 1
+	h.counts = make([]uint32, h.width*h.height)
+	for y := 0; y < g.height; y++ {
+		for x := 0; x < g.width; x++ {
+			i := ((g.y0+y)>>1-h.y0)*h.width + (g.x0+x)>>1 - h.x0
+			h.counts[i] = max(h.counts[i], g.counts[y*g.width+x])
+		}
+	}
+	return h
+}
+
+// Returns the largest count of the grid.
+func (g *grid) peak() uint32 {
+	var m uint32
+	for _, c := range g.counts {
+		m = max(m, c)
+	}
+	return m
+}
+
+// Returns a heatmap covering the bounds at the resolution of the given zoom level: at zoom 16 a
+// cell is about 2 meters wide. Returns ErrHeatmapTooLarge when the grid would exceed maxHeatmapCells.
+func NewHeatmap(bounds gostrava.Bounds, zoom int) (*Heatmap, error) {
+	if zoom < 0 || zoom > maxHeatmapZoom {
+		return nil, fmt.Errorf("invalid heatmap zoom %d", zoom)
+	}
+
+	x0, y0 := globalPixel(gostrava.LatLng{bounds.NELat, bounds.SWLng}, zoom)
+	x1, y1 := globalPixel(gostrava.LatLng{bounds.SWLat, bounds.NELng}, zoom)
+	g := grid{x0: int(x0), y0: int(y0), width: int(x1) - int(x0) + 1, height: int(y1) - int(y0) + 1}
+	if g.width <= 0 || g.height <= 0 || g.width*g.height > maxHeatmapCells {
+		return nil, ErrHeatmapTooLarge
+	}
+	g.counts = make([]uint32, g.width*g.height)
+
+	return &Heatmap{Zoom: zoom, Bounds: bounds, grid: g}, nil
+}
+
+// Returns the global pixel of a coordinate at a zoom level, as used by slippy map tiles.
+func globalPixel(ll gostrava.LatLng, zoom int) (x, y float64) {
+	mx, my := mercator(ll)
+	size := float64(int(tileSize) << zoom)
+	return mx * size, my * size
+}
+
+// Returns the coordinate of a global pixel at a zoom level.
+func globalLatLng(x, y float64, zoom int) gostrava.LatLng {
+	size := float64(int(tileSize) << zoom)
+	lng := x/size*360 - 180
+	lat := math.Atan(math.Sinh(math.Pi*(1-2*y/size))) * 180 / math.Pi
+	return gostrava.LatLng{float32(lat), float32(lng)}
+}
+
+// Adds a track to the heatmap. Each cell it crosses is counted once per track, so that a loop ridden
+// slowly does not outweigh other activities.
+func (h *Heatmap) AddTrack(points []gostrava.LatLng) {
+	visited := map[int]bool{}
+	for i := range points {
+		x1, y1 := globalPixel(points[i], h.Zoom)
+		x0, y0 := x1, y1
+		if i > 0 {
+			x0, y0 = globalPixel(points[i-1], h.Zoom)
+		}
+
+		steps := int(math.Ceil(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))))
+		for s := 0; s <= steps; s++ {
+			t := 0.0
+			if steps > 0 {
+				t = float64(s) / float64(steps)
+			}
+			x := int(x0+t*(x1-x0)) - h.x0
+			y := int(y0+t*(y1-y0)) - h.y0
+			if x < 0 || y < 0 || x >= h.width || y >= h.height {
+				continue
+			}
+			if c := y*h.width + x; !visited[c] {
+				visited[c] = true
+				h.counts[c]++
+			}
+		}
+	}
+}
+
+// Adds the track of an activity from its summary polyline.
+func (h *Heatmap) AddActivity(a *gostrava.ActivitySummary) error {
+	points, err := a.Map.Decode()
+	if err != nil {
+		return err
+	}
+	h.AddTrack(points)
+	return nil
+}
+
+// Adds the activities that pass the filter, from their summary polylines. Returns the number added.
+func (h *Heatmap) AddActivities(activities []gostrava.ActivitySummary, filter HeatmapFilter) (int, error) {
+	added := 0
+	for i := range activities {
+		if !filter.Match(&activities[i]) {
+			continue
+		}
+		if err := h.AddActivity(&activities[i]); err != nil {
+			return added, err
+		}
+		added++
+	}
+	return added, nil
+}
+
+// Adds the track of an activity from its LatLngStream, which is more detailed than its summary polyline.
+func (h *Heatmap) AddStreams(set *gostrava.StreamSet) error {
+	if set == nil {
+		return ErrNilStreamSet
+	}
+	if set.LatLngStream == nil {
+		return fmt.Errorf("%w: latlng", ErrMissingStream)
+	}
+	h.AddTrack(set.LatLngStream.Data)
+	return nil
+}
+
+// Returns the colour of a cell on a log scale up to the largest count, transparent when empty.
+func heatColor(count, peak uint32) color.Color {
+	if count == 0 || peak == 0 {
+		return color.RGBA{}
+	}
+	f := math.Log1p(float64(count)) / math.Log1p(float64(peak))
+	c := ramp(0.35 + 0.65*f)
+	a := 0.4 + 0.6*f
+	return color.NRGBA{R: c.R, G: c.G, B: c.B, A: uint8(a * 0xff)}
+}
+
+// Draws the heatmap, one pixel per cell.
+func (h *Heatmap) Image() *image.NRGBA {
+	return h.grid.image(h.peak(), h.x0, h.y0, h.width, h.height)
+}
+
+// Draws the window of the grid starting at the global pixel (x0, y0).
+func (g *grid) image(peak uint32, x0, y0, width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if c := g.at(x0+x, y0+y); c > 0 {
+				img.Set(x, y, heatColor(c, peak))
+			}
+		}
+	}
+	return img
+}
+
+// Writes the heatmap as a PNG image, one pixel per cell.
+func (h *Heatmap) PNG(w io.Writer) error {
+	return png.Encode(w, h.Image())
+}
+
+// Writes the non-empty cells of the heatmap as a GeoJSON feature collection of polygons with their
+// count and their density, the count relative to the largest one. Features are written one at a time,
+// so memory does not grow with the number of cells.
+func (h *Heatmap) GeoJSON(w io.Writer) error {
+	peak := h.peak()
+	b := bufio.NewWriter(w)
+	if _, err := b.WriteString(`{"type":"FeatureCollection","features":[`); err != nil {
+		return err
+	}
+
+	first := true
+	for y := 0; y < h.height; y++ {
+		for x := 0; x < h.width; x++ {
+			c := h.counts[y*h.width+x]
+			if c == 0 {
+				continue
+			}
+
+			gx, gy := float64(h.x0+x), float64(h.y0+y)
+			ring := []gostrava.LatLng{
+				globalLatLng(gx, gy, h.Zoom),
+				globalLatLng(gx+1, gy, h.Zoom),
+				globalLatLng(gx+1, gy+1, h.Zoom),
+				globalLatLng(gx, gy+1, h.Zoom),
+			}
+			feature, err := json.Marshal(export.NewFeature(export.Polygon(ring), map[string]interface{}{
+				"count":   c,
+				"density": float64(c) / float64(peak),
+			}))
+			if err != nil {
+				return err
+			}
+
+			if !first {
+				b.WriteByte(',')
+			}
+			first = false
+			if _, err := b.Write(feature); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := b.WriteString("]}\n"); err != nil {
+		return err
+	}
+	return b.Flush()
+}
+
+// Writes the heatmap as slippy map tiles, dir/{z}/{x}/{y}.png, from the heatmap's zoom level up to
+// minZoom. Lower zoom levels keep the largest count of the cells they merge. Empty tiles are skipped.
+func (h *Heatmap) WriteTiles(dir string, minZoom int) error {
+	peak := h.peak()
+	g := &h.grid
+	for z := h.Zoom; z >= max(minZoom, 0); z-- {
+		for ty := g.y0 / tileSize; ty <= (g.y0+g.height-1)/tileSize; ty++ {
+			for tx := g.x0 / tileSize; tx <= (g.x0+g.width-1)/tileSize; tx++ {
+				if err := writeTile(dir, g, peak, z, tx, ty); err != nil {
+					return err
+				}
+			}
+		}
+		if z > 0 {
+			g = g.halve()
+		}
+	}
+	return nil
+}
+
+func writeTile(dir string, g *grid, peak uint32, z, tx, ty int) error {
+	img := g.image(peak, tx*tileSize, ty*tileSize, tileSize, tileSize)
+
+	empty := true
+	for i := 3; i < len(img.Pix) && empty; i += 4 {
+		empty = img.Pix[i] == 0
+	}
+	if empty {
+		return nil
+	}
+
+	path := filepath.Join(dir, strconv.Itoa(z), strconv.Itoa(tx))
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(path, strconv.Itoa(ty)+".png"))
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
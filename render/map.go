@@ -0,0 +1,292 @@
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/guisaez/gostrava"
+)
+
+type ColorBy int
+
+const (
+	SolidColor       ColorBy = iota // A single colour, MapOpts.Color
+	ColorBySpeed                    // From the SmoothVelocityStream
+	ColorByHeartRate                // From the HeartRateStream
+	ColorByPower                    // From the WattsStream
+)
+
+// Number of distinct colours used along a coloured line.
+const colorLevels = 32
+
+// A line to draw, with an optional value at each point to colour it by.
+type Track struct {
+	Points []gostrava.LatLng
+	Values []float64 // Colours the line from low (blue) to high (red) values when set. NaN values are drawn in MapOpts.Color
+}
+
+// Returns the track of a map's summary polyline.
+func TrackFromMap(m gostrava.PolylineSummmary) (*Track, error) {
+	points, err := m.Decode()
+	if err != nil {
+		return nil, err
+	}
+	return &Track{Points: points}, nil
+}
+
+// Returns the track of a set's LatLngStream, coloured by one of its streams.
+func TrackFromStreams(set *gostrava.StreamSet, by ColorBy) (*Track, error) {
+	if set == nil {
+		return nil, ErrNilStreamSet
+	}
+	if set.LatLngStream == nil {
+		return nil, fmt.Errorf("%w: latlng", ErrMissingStream)
+	}
+
+	track := &Track{Points: set.LatLngStream.Data}
+	if by == SolidColor {
+		return track, nil
+	}
+
+	track.Values = make([]float64, len(track.Points))
+	for i := range track.Values {
+		track.Values[i] = math.NaN()
+	}
+
+	switch by {
+	case ColorBySpeed:
+		if set.SmoothVelocityStream == nil {
+			return nil, fmt.Errorf("%w: velocity_smooth", ErrMissingStream)
+		}
+		for i, v := range set.SmoothVelocityStream.Data[:min(len(track.Values), len(set.SmoothVelocityStream.Data))] {
+			track.Values[i] = float64(v)
+		}
+	case ColorByHeartRate:
+		if set.HeartRateStream == nil {
+			return nil, fmt.Errorf("%w: heartrate", ErrMissingStream)
+		}
+		for i, v := range set.HeartRateStream.Data[:min(len(track.Values), len(set.HeartRateStream.Data))] {
+			track.Values[i] = float64(v)
+		}
+	case ColorByPower:
+		if set.WattsStream == nil {
+			return nil, fmt.Errorf("%w: watts", ErrMissingStream)
+		}
+		for i, v := range set.WattsStream.Data[:min(len(track.Values), len(set.WattsStream.Data))] {
+			track.Values[i] = float64(v)
+		}
+	}
+
+	return track, nil
+}
+
+type MapOpts struct {
+	Width      int                 // The width of the image, in pixels. Defaults to 800
+	Height     int                 // The height of the image, in pixels. Defaults to 600
+	Padding    int                 // The margin around the fitted bounds, in pixels. Defaults to 20
+	Bounds     *gostrava.Bounds    // The area to fit in the image. Defaults to the bounds of the track
+	LineWidth  float64             // The width of the line, in pixels. Defaults to 3
+	Color      color.Color         // The colour of the line when it has no values. Defaults to DefaultColor
+	Background color.Color         // The background colour. Defaults to transparent
+	Markers    bool                // Whether to mark the start and the end of the track
+	Waypoints  []gostrava.Waypoint // Waypoints to mark, such as those of a route
+}
+
+func (o *MapOpts) defaults() {
+	if o.Width <= 0 {
+		o.Width = 800
+	}
+	if o.Height <= 0 {
+		o.Height = 600
+	}
+	if o.Padding <= 0 {
+		o.Padding = 20
+	}
+	if o.LineWidth <= 0 {
+		o.LineWidth = 3
+	}
+	if o.Color == nil {
+		o.Color = DefaultColor
+	}
+}
+
+// A track projected onto the image, split into runs of the same colour.
+type mapLayout struct {
+	runs      []run
+	start     [2]float64
+	end       [2]float64
+	waypoints [][2]float64
+}
+
+type run struct {
+	color  color.Color
+	points [][2]float64
+}
+
+func layoutMap(track *Track, opts MapOpts) (*mapLayout, error) {
+	if track == nil || len(track.Points) == 0 {
+		return nil, ErrEmptyTrack
+	}
+
+	bounds := gostrava.NewBounds(track.Points...)
+	if opts.Bounds != nil {
+		bounds = *opts.Bounds
+	}
+	view := newViewport(bounds, opts.Width, opts.Height, opts.Padding)
+
+	pixels := make([][2]float64, len(track.Points))
+	for i, ll := range track.Points {
+		pixels[i][0], pixels[i][1] = view.pixel(ll)
+	}
+
+	colors := segmentColors(track, opts.Color)
+
+	layout := &mapLayout{start: pixels[0], end: pixels[len(pixels)-1]}
+	for i := 1; i < len(pixels); i++ {
+		if n := len(layout.runs); n > 0 && layout.runs[n-1].color == colors[i] {
+			layout.runs[n-1].points = append(layout.runs[n-1].points, pixels[i])
+			continue
+		}
+		layout.runs = append(layout.runs, run{color: colors[i], points: [][2]float64{pixels[i-1], pixels[i]}})
+	}
+	if len(pixels) == 1 {
+		layout.runs = []run{{color: opts.Color, points: pixels}}
+	}
+
+	for _, w := range opts.Waypoints {
+		var p [2]float64
+		p[0], p[1] = view.pixel(w.LatLng)
+		layout.waypoints = append(layout.waypoints, p)
+	}
+
+	return layout, nil
+}
+
+// Returns the colour of the segment ending at each point. Values are spread between their 5th and
+// 95th percentiles so that a few spikes do not flatten the scale.
+func segmentColors(track *Track, solid color.Color) []color.Color {
+	colors := make([]color.Color, len(track.Points))
+	if len(track.Values) == 0 {
+		for i := range colors {
+			colors[i] = solid
+		}
+		return colors
+	}
+
+	p := percentiles(track.Values, 0.05, 0.95)
+	lo, hi := p[0], p[1]
+	for i := range colors {
+		v := math.NaN()
+		if i < len(track.Values) {
+			v = track.Values[i]
+			if i > 0 && !math.IsNaN(track.Values[i-1]) {
+				v = (v + track.Values[i-1]) / 2
+			}
+		}
+		if math.IsNaN(v) {
+			colors[i] = solid
+			continue
+		}
+
+		f := 0.5
+		if hi > lo {
+			f = (v - lo) / (hi - lo)
+		}
+		level := math.Round(math.Max(0, math.Min(1, f)) * (colorLevels - 1))
+		colors[i] = ramp(level / (colorLevels - 1))
+	}
+	return colors
+}
+
+// Writes the track as an SVG image.
+func MapSVG(w io.Writer, track *Track, opts MapOpts) error {
+	opts.defaults()
+	layout, err := layoutMap(track, opts)
+	if err != nil {
+		return err
+	}
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", opts.Width, opts.Height, opts.Width, opts.Height)
+	if opts.Background != nil {
+		fmt.Fprintf(b, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", hex(opts.Background))
+	}
+
+	fmt.Fprintf(b, `<g fill="none" stroke-width="%g" stroke-linecap="round" stroke-linejoin="round">`+"\n", opts.LineWidth)
+	for _, r := range layout.runs {
+		fmt.Fprintf(b, `<polyline stroke="%s" points="`, hex(r.color))
+		for i, p := range r.points {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			fmt.Fprintf(b, "%.1f,%.1f", p[0], p[1])
+		}
+		b.WriteString("\"/>\n")
+	}
+	b.WriteString("</g>\n")
+
+	r := opts.LineWidth + 2
+	for _, p := range layout.waypoints {
+		fmt.Fprintf(b, `<circle cx="%.1f" cy="%.1f" r="%g" fill="%s" stroke="#ffffff" stroke-width="1.5"/>`+"\n", p[0], p[1], r, hex(waypointColor))
+	}
+	if opts.Markers {
+		fmt.Fprintf(b, `<circle cx="%.1f" cy="%.1f" r="%g" fill="%s" stroke="#ffffff" stroke-width="1.5"/>`+"\n", layout.start[0], layout.start[1], r, hex(startColor))
+		fmt.Fprintf(b, `<circle cx="%.1f" cy="%.1f" r="%g" fill="%s" stroke="#ffffff" stroke-width="1.5"/>`+"\n", layout.end[0], layout.end[1], r, hex(endColor))
+	}
+
+	b.WriteString("</svg>\n")
+	return b.Flush()
+}
+
+// Draws the track onto a new image.
+func MapImage(track *Track, opts MapOpts) (*image.RGBA, error) {
+	opts.defaults()
+	layout, err := layoutMap(track, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	if opts.Background != nil {
+		draw.Draw(img, img.Bounds(), image.NewUniform(opts.Background), image.Point{}, draw.Src)
+	}
+
+	for _, r := range layout.runs {
+		for i := 1; i < len(r.points); i++ {
+			a, b := r.points[i-1], r.points[i]
+			drawLine(img, a[0], a[1], b[0], b[1], opts.LineWidth, r.color)
+		}
+		if len(r.points) == 1 {
+			fillDisc(img, r.points[0][0], r.points[0][1], opts.LineWidth/2, r.color)
+		}
+	}
+
+	marker := func(p [2]float64, c color.Color) {
+		fillDisc(img, p[0], p[1], opts.LineWidth+3, white)
+		fillDisc(img, p[0], p[1], opts.LineWidth+1.5, c)
+	}
+	for _, p := range layout.waypoints {
+		marker(p, waypointColor)
+	}
+	if opts.Markers {
+		marker(layout.start, startColor)
+		marker(layout.end, endColor)
+	}
+
+	return img, nil
+}
+
+// Writes the track as a PNG image.
+func MapPNG(w io.Writer, track *Track, opts MapOpts) error {
+	img, err := MapImage(track, opts)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
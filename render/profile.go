@@ -0,0 +1,255 @@
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/guisaez/gostrava"
+	"github.com/guisaez/gostrava/analysis"
+)
+
+const (
+	feetPerMeter  = 3.28084
+	metersPerMile = 1609.344
+)
+
+// Margins of the plot area of an elevation profile, in pixels.
+const (
+	profileLeft   = 50
+	profileRight  = 15
+	profileTop    = 34
+	profileBottom = 26
+)
+
+// Gradient bands of an elevation profile: the lowest grade, in percents, of each band and its colour.
+var gradeBands = []struct {
+	grade float64
+	color color.RGBA
+}{
+	{math.Inf(-1), color.RGBA{R: 0xb0, G: 0xbe, B: 0xc5, A: 0xff}},
+	{0, color.RGBA{R: 0x9c, G: 0xcc, B: 0x65, A: 0xff}},
+	{3, color.RGBA{R: 0xff, G: 0xd5, B: 0x4f, A: 0xff}},
+	{6, color.RGBA{R: 0xff, G: 0x98, B: 0x00, A: 0xff}},
+	{9, color.RGBA{R: 0xe6, G: 0x4a, B: 0x19, A: 0xff}},
+	{12, color.RGBA{R: 0xb7, G: 0x1c, B: 0x1c, A: 0xff}},
+}
+
+var climbCategoryNames = []string{"", "Cat 4", "Cat 3", "Cat 2", "Cat 1", "HC"}
+
+type ProfileOpts struct {
+	Width      int                     // The width of the image, in pixels. Defaults to 800
+	Height     int                     // The height of the image, in pixels. Defaults to 240
+	Units      string                  // The unit system of the axes, as AthleteDetailed.MeasurementPreference: "meters" or "feet". Defaults to meters
+	Background color.Color             // The background colour. Defaults to transparent
+	Elevation  analysis.ElevationOpts  // The smoothing of the altitude and the detection of climbs
+	Climbs     []analysis.ClimbSegment // The climbs to annotate. When nil they are detected with analysis.DetectClimbs
+	Waypoints  []gostrava.Waypoint     // Waypoints to mark at their DistanceIntoRoute
+}
+
+// Returns the options for the athlete's preferred unit system, or the default options for a nil athlete.
+func ProfileOptsFor(athlete *gostrava.AthleteDetailed) ProfileOpts {
+	if athlete == nil {
+		return ProfileOpts{}
+	}
+	return ProfileOpts{Units: athlete.MeasurementPreference}
+}
+
+func (o *ProfileOpts) defaults() {
+	if o.Width <= 0 {
+		o.Width = 800
+	}
+	if o.Height <= 0 {
+		o.Height = 240
+	}
+}
+
+// Writes the elevation profile of an activity, route or segment as an SVG image, from the
+// DistanceStream and AltitudeStream of its set. The area under the profile is shaded by gradient,
+// climbs are annotated with their category, length and average grade, and waypoints are marked.
+func ProfileSVG(w io.Writer, set *gostrava.StreamSet, opts ProfileOpts) error {
+	opts.defaults()
+
+	summary, err := analysis.Elevation(set, opts.Elevation)
+	if err != nil {
+		return err
+	}
+	if opts.Climbs == nil {
+		if opts.Climbs, err = analysis.DetectClimbs(set, opts.Elevation); err != nil {
+			return err
+		}
+	}
+
+	alt := summary.Altitude
+	if set.DistanceStream == nil || len(set.DistanceStream.Data) < len(alt) {
+		return fmt.Errorf("%w: distance", ErrMissingStream)
+	}
+	dist := make([]float64, len(alt))
+	for i := range dist {
+		dist[i] = float64(set.DistanceStream.Data[i])
+	}
+	if len(alt) < 2 || dist[len(dist)-1] <= dist[0] {
+		return analysis.ErrNoSamples
+	}
+
+	imperial := opts.Units == "feet"
+	altUnit, distUnit, altScale, distScale := "m", "km", 1.0, 1000.0
+	if imperial {
+		altUnit, distUnit, altScale, distScale = "ft", "mi", feetPerMeter, metersPerMile
+	}
+
+	// Axes ranges, in display units
+	x0, x1 := dist[0]/distScale, dist[len(dist)-1]/distScale
+	yStep := niceStep((summary.ElevationHigh-summary.ElevationLow)*altScale, 4)
+	y0 := math.Floor(summary.ElevationLow*altScale/yStep) * yStep
+	y1 := math.Ceil(summary.ElevationHigh*altScale/yStep) * yStep
+	if y1 <= y0 {
+		y1 = y0 + yStep
+	}
+
+	plotW := float64(opts.Width - profileLeft - profileRight)
+	plotH := float64(opts.Height - profileTop - profileBottom)
+	px := func(d float64) float64 { return profileLeft + (d/distScale-x0)/(x1-x0)*plotW }
+	py := func(a float64) float64 { return profileTop + (1-(a*altScale-y0)/(y1-y0))*plotH }
+	base := py(y0 / altScale)
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n", opts.Width, opts.Height, opts.Width, opts.Height)
+	if opts.Background != nil {
+		fmt.Fprintf(b, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", hex(opts.Background))
+	}
+
+	// Grid lines, behind the profile
+	b.WriteString(`<g stroke="#cfd8dc" stroke-width="1">` + "\n")
+	for y := y0; y <= y1+yStep/2; y += yStep {
+		fmt.Fprintf(b, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f"/>`+"\n", profileLeft, py(y/altScale), profileLeft+plotW, py(y/altScale))
+	}
+	b.WriteString("</g>\n")
+
+	// Gradient bands, one polygon per run of samples in the same band
+	chunk := math.Max(100, (dist[len(dist)-1]-dist[0])/200)
+	for _, r := range gradeRuns(dist, alt, chunk) {
+		b.WriteString(`<polygon fill="` + hex(gradeBands[r.band].color) + `" points="`)
+		fmt.Fprintf(b, "%.1f,%.1f", px(dist[r.start]), base)
+		for i := r.start; i <= r.end; i++ {
+			fmt.Fprintf(b, " %.1f,%.1f", px(dist[i]), py(alt[i]))
+		}
+		fmt.Fprintf(b, " %.1f,%.1f\"/>\n", px(dist[r.end]), base)
+	}
+
+	// Profile line
+	b.WriteString(`<polyline fill="none" stroke="#37474f" stroke-width="1.5" points="`)
+	for i := range alt {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(b, "%.1f,%.1f", px(dist[i]), py(alt[i]))
+	}
+	b.WriteString("\"/>\n")
+
+	// Axes labels
+	b.WriteString(`<g fill="#546e7a">` + "\n")
+	for y := y0; y <= y1+yStep/2; y += yStep {
+		fmt.Fprintf(b, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%s %s</text>`+"\n", profileLeft-4, py(y/altScale), formatTick(y), altUnit)
+	}
+	xStep := niceStep(x1-x0, 6)
+	for x := math.Ceil(x0/xStep) * xStep; x <= x1+1e-9; x += xStep {
+		fmt.Fprintf(b, `<text x="%.1f" y="%.1f" text-anchor="middle">%s %s</text>`+"\n", px(x*distScale), base+16, formatTick(x), distUnit)
+	}
+	b.WriteString("</g>\n")
+
+	// Climbs, bracketed above the profile
+	for _, c := range opts.Climbs {
+		if c.EndIndex >= len(alt) {
+			continue
+		}
+		xa, xb := px(dist[c.StartIndex]), px(dist[c.EndIndex])
+		y := py(float64(c.ElevationHigh)) - 8
+
+		label := fmt.Sprintf("%.1f %s · %.1f%%", float64(c.Distance)/distScale, distUnit, c.AvgGrade)
+		if name := climbCategoryNames[max(0, min(int(c.ClimbCategory), len(climbCategoryNames)-1))]; name != "" {
+			label = name + " · " + label
+		}
+
+		fmt.Fprintf(b, `<path d="M%.1f,%.1f V%.1f H%.1f V%.1f" fill="none" stroke="#37474f" stroke-width="1"/>`+"\n", xa, y+4, y, xb, y+4)
+		fmt.Fprintf(b, `<text x="%.1f" y="%.1f" text-anchor="middle" fill="#263238">%s</text>`+"\n", (xa+xb)/2, y-4, html.EscapeString(label))
+	}
+
+	// Waypoints
+	for _, wp := range opts.Waypoints {
+		d := float64(wp.DistanceIntoRoute)
+		if d < dist[0] || d > dist[len(dist)-1] {
+			continue
+		}
+		x := px(d)
+		fmt.Fprintf(b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.1f" stroke="%s" stroke-dasharray="3,3"/>`+"\n", x, profileTop-12, x, base, hex(waypointColor))
+		fmt.Fprintf(b, `<text x="%.1f" y="%d" text-anchor="middle" fill="%s">%s</text>`+"\n", x, profileTop-16, hex(waypointColor), html.EscapeString(wp.Title))
+	}
+
+	b.WriteString("</svg>\n")
+	return b.Flush()
+}
+
+// A run of consecutive samples in the same gradient band.
+type gradeRun struct {
+	start, end, band int
+}
+
+// Splits the profile into runs of the same gradient band, measuring the grade over chunks of the
+// given length so that the shading follows the terrain rather than the noise.
+func gradeRuns(dist, alt []float64, chunk float64) []gradeRun {
+	runs := []gradeRun{}
+	start := 0
+	for start < len(dist)-1 {
+		end := start + 1
+		for end < len(dist)-1 && dist[end]-dist[start] < chunk {
+			end++
+		}
+
+		band := 0
+		if d := dist[end] - dist[start]; d > 0 {
+			grade := (alt[end] - alt[start]) / d * 100
+			for i, g := range gradeBands {
+				if grade >= g.grade {
+					band = i
+				}
+			}
+		}
+
+		if n := len(runs); n > 0 && runs[n-1].band == band {
+			runs[n-1].end = end
+		} else {
+			runs = append(runs, gradeRun{start: start, end: end, band: band})
+		}
+		start = end
+	}
+	return runs
+}
+
+// Returns a round step, 1, 2 or 5 times a power of ten, splitting the span into about the given number of ticks.
+func niceStep(span float64, ticks int) float64 {
+	if span <= 0 {
+		return 1
+	}
+	raw := span / float64(ticks)
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if m*mag >= raw {
+			return m * mag
+		}
+	}
+	return 10 * mag
+}
+
+func formatTick(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
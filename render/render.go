@@ -0,0 +1,150 @@
+// Package render draws activities, routes and segments into SVG and PNG images without any map
+// service, for share cards, emails and reports.
+package render
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+
+	"github.com/guisaez/gostrava"
+)
+
+var (
+	ErrEmptyTrack    = errors.New("track has no points")
+	ErrNilStreamSet  = errors.New("stream set is nil")
+	ErrMissingStream = errors.New("missing stream")
+)
+
+// The default colour of lines, Strava orange.
+var DefaultColor = color.RGBA{R: 0xfc, G: 0x4c, B: 0x02, A: 0xff}
+
+var (
+	startColor    = color.RGBA{R: 0x2e, G: 0xa0, B: 0x43, A: 0xff}
+	endColor      = color.RGBA{R: 0xd3, G: 0x2f, B: 0x2f, A: 0xff}
+	waypointColor = color.RGBA{R: 0x1e, G: 0x6f, B: 0xd9, A: 0xff}
+	white         = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+)
+
+// Projects a coordinate with the Web Mercator projection onto the unit square, with x growing
+// eastwards and y southwards, as on slippy maps.
+func mercator(ll gostrava.LatLng) (x, y float64) {
+	lat := math.Max(-85.05112878, math.Min(85.05112878, float64(ll[0]))) * math.Pi / 180
+	x = (float64(ll[1]) + 180) / 360
+	y = (1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2
+	return x, y
+}
+
+// Maps coordinates onto the pixels of an image so that some bounds fit within its padding.
+type viewport struct {
+	scale, offsetX, offsetY float64
+}
+
+func newViewport(bounds gostrava.Bounds, width, height, padding int) viewport {
+	x0, y0 := mercator(gostrava.LatLng{bounds.NELat, bounds.SWLng})
+	x1, y1 := mercator(gostrava.LatLng{bounds.SWLat, bounds.NELng})
+
+	w, h := float64(width-2*padding), float64(height-2*padding)
+	scale := math.Inf(1)
+	if x1 > x0 {
+		scale = w / (x1 - x0)
+	}
+	if y1 > y0 {
+		scale = math.Min(scale, h/(y1-y0))
+	}
+	if math.IsInf(scale, 1) {
+		// A single point, zoomed in as a street map would be
+		scale = 1 << 20
+	}
+
+	return viewport{
+		scale:   scale,
+		offsetX: float64(width)/2 - (x0+x1)/2*scale,
+		offsetY: float64(height)/2 - (y0+y1)/2*scale,
+	}
+}
+
+func (v viewport) pixel(ll gostrava.LatLng) (x, y float64) {
+	mx, my := mercator(ll)
+	return mx*v.scale + v.offsetX, my*v.scale + v.offsetY
+}
+
+// Returns the colour of a value between 0 and 1 on a blue, green, yellow and red scale.
+func ramp(f float64) color.RGBA {
+	stops := []color.RGBA{
+		{R: 0x31, G: 0x6a, B: 0xd8, A: 0xff},
+		{R: 0x2e, G: 0xb8, B: 0x5c, A: 0xff},
+		{R: 0xf5, G: 0xd0, B: 0x2a, A: 0xff},
+		{R: 0xe0, G: 0x2b, B: 0x2b, A: 0xff},
+	}
+
+	f = math.Max(0, math.Min(1, f)) * float64(len(stops)-1)
+	i := min(int(f), len(stops)-2)
+	t := f - float64(i)
+	a, b := stops[i], stops[i+1]
+	mix := func(x, y uint8) uint8 { return uint8(float64(x) + t*(float64(y)-float64(x)) + 0.5) }
+	return color.RGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: 0xff}
+}
+
+// Returns the values at the given fractions of their sorted order, ignoring NaNs.
+func percentiles(values []float64, fractions ...float64) []float64 {
+	sorted := make([]float64, 0, len(values))
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			sorted = append(sorted, v)
+		}
+	}
+	sort.Float64s(sorted)
+
+	out := make([]float64, len(fractions))
+	if len(sorted) == 0 {
+		return out
+	}
+	for i, f := range fractions {
+		out[i] = sorted[int(f*float64(len(sorted)-1))]
+	}
+	return out
+}
+
+func hex(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+// An anti-aliased disc, used as a mask to draw thick lines and markers with image/draw.
+type disc struct {
+	x, y, r float64
+}
+
+func (d disc) ColorModel() color.Model { return color.AlphaModel }
+
+func (d disc) Bounds() image.Rectangle {
+	return image.Rect(int(math.Floor(d.x-d.r)), int(math.Floor(d.y-d.r)), int(math.Ceil(d.x+d.r))+1, int(math.Ceil(d.y+d.r))+1)
+}
+
+func (d disc) At(x, y int) color.Color {
+	dist := math.Hypot(float64(x)+0.5-d.x, float64(y)+0.5-d.y)
+	return color.Alpha{A: uint8(math.Max(0, math.Min(1, d.r-dist+0.5)) * 0xff)}
+}
+
+func fillDisc(img draw.Image, x, y, r float64, c color.Color) {
+	d := disc{x: x, y: y, r: r}
+	draw.DrawMask(img, d.Bounds(), image.NewUniform(c), image.Point{}, d, d.Bounds().Min, draw.Over)
+}
+
+// Draws a thick line by stamping discs along it.
+func drawLine(img draw.Image, x0, y0, x1, y1, width float64, c color.Color) {
+	r := width / 2
+	steps := int(math.Ceil(math.Hypot(x1-x0, y1-y0) / math.Max(r/2, 0.5)))
+	for i := 0; i <= steps; i++ {
+		t := 0.0
+		if steps > 0 {
+			t = float64(i) / float64(steps)
+		}
+		fillDisc(img, x0+t*(x1-x0), y0+t*(y1-y0), r, c)
+	}
+}
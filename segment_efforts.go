@@ -7,6 +7,7 @@ import (
 )
 
 type SegmentEffortDetailed struct {
+	SegmentEffortSummary
 	Name         *string         `json:"name,omitempty"`              // The name of the segment on which this effort was performed
 	Activity     *ActivityMeta   `json:"activity,omitempty"`          // An instance of MetaActivity.
 	Athlete      *AthleteMeta    `json:"athlete,omitempty"`           // An instance of MetaAthlete.
@@ -57,10 +58,10 @@ func (s *SegmentEffortsService) GetSegmentEffort(accessToken string, id int) (*S
 }
 
 type ListSegmentEffortOptions struct {
-	Page           int // Page number. Defaults to 1
-	PerPage        int // Number of items per page. Defaults to 30
-	StartDateLocal time.Time
-	EndDateLocal   time.Time
+	Page           int       // Page number. Defaults to 1
+	PerPage        int       // Number of items per page. Defaults to 30
+	StartDateLocal time.Time // Only efforts started at or after this local time, if set
+	EndDateLocal   time.Time // Only efforts started at or before this local time, if set
 }
 
 // Returns a set of the authenticated athlete's segment efforts for a given segment. Requires subscription
@@ -69,12 +70,15 @@ func (s *SegmentEffortsService) ListSegmentEfforts(accessToken string, segmentID
 
 	params.Set("segment_id", strconv.Itoa(segmentID))
 
-	if opts.StartDateLocal.IsZero() {
+	if !opts.StartDateLocal.IsZero() {
 		params.Set("start_date_local", opts.StartDateLocal.Format(time.RFC3339))
 	}
-	if opts.EndDateLocal.IsZero() {
+	if !opts.EndDateLocal.IsZero() {
 		params.Set("end_date_local", opts.EndDateLocal.Format(time.RFC3339))
 	}
+	if opts.Page > 0 {
+		params.Set("page", strconv.Itoa(opts.Page))
+	}
 	if opts.PerPage > 0 {
 		params.Set("per_page", strconv.Itoa(opts.PerPage))
 	}
@@ -82,6 +86,7 @@ func (s *SegmentEffortsService) ListSegmentEfforts(accessToken string, segmentID
 	req, err := s.client.NewRequest(RequestOpts{
 		Path:        "segment_efforts",
 		AccessToken: accessToken,
+		Body:        params,
 	})
 	if err != nil {
 		return nil, err
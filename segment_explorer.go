@@ -0,0 +1,122 @@
+package gostrava
+
+import (
+	"errors"
+	"time"
+)
+
+const explorerLimit = 10 // The number of segments returned by ExploreSegments at most
+
+var ErrExploreBudget = errors.New("explorer request budget exhausted")
+
+type ExploreRegionOpts struct {
+	ExploreSegmentsOpts                   // The activity type and climb categories of the segments
+	MinTileSize         float32           // The side of the smallest tile, in degrees, that is not subdivided. Defaults to 0.005, about 500 meters
+	MaxRequests         int               // The largest number of requests to make. Unlimited when 0
+	Reserve             int               // The requests of each rate limit window left for other uses
+	Wait                bool              // Whether to wait for the rate limit window to end instead of returning ErrRateLimitReached
+	MaxWait             time.Duration     // The longest wait for a rate limit window to end, beyond which ErrRateLimitReached is returned. Unlimited when 0
+	Overlaps            func(Bounds) bool // Whether a quarter of a split tile overlaps the area of interest and is explored. All are when nil
+}
+
+// Returns all the segments in the bounds rather than the top 10 returned by ExploreSegments. The
+// bounds are explored as a tile that is split into four, recursively, while it returns 10 segments,
+// and segments found in several tiles are returned once, in the order they were found.
+//
+// Before each request the rate limits reported by the last response are checked: when fewer than
+// opts.Reserve requests are left, it waits for the window to end if opts.Wait is set, which can be
+// until the next UTC day once the daily limit is reached unless opts.MaxWait is shorter, and returns
+// ErrRateLimitReached otherwise. A tile answered with an empty body counts as empty. On error, the segments found so far are returned along with it.
+func (s *SegmentsService) ExploreRegion(accessToken string, bounds Bounds, opts ExploreRegionOpts) ([]*ExplorerSegment, error) {
+	return s.ExploreTiles(accessToken, []Bounds{bounds}, opts)
+}
+
+// Explores each of the tiles as ExploreRegion does, in order, with opts.MaxRequests as the budget of
+// the whole exploration. Segments found in several tiles are returned once.
+func (s *SegmentsService) ExploreTiles(accessToken string, tiles []Bounds, opts ExploreRegionOpts) ([]*ExplorerSegment, error) {
+	if opts.MinTileSize <= 0 {
+		opts.MinTileSize = 0.005
+	}
+
+	segments := []*ExplorerSegment{}
+	seen := map[int]bool{}
+	requests := 0
+
+	// The tiles left to explore, the next one last
+	stack := make([]Bounds, len(tiles))
+	for i, tile := range tiles {
+		stack[len(tiles)-1-i] = tile
+	}
+	tiles = stack
+
+	for len(tiles) > 0 {
+		tile := tiles[len(tiles)-1]
+
+		if opts.MaxRequests > 0 && requests >= opts.MaxRequests {
+			return segments, ErrExploreBudget
+		}
+		if err := s.waitRateLimit(opts); err != nil {
+			return segments, err
+		}
+
+		requests++
+		resp, err := s.ExploreSegments(accessToken, tile, opts.ExploreSegmentsOpts)
+		if err != nil {
+			// A request rejected for exceeding the rate limit is retried once the window ends
+			if opts.Wait && s.client.RateLimit().Known() && s.client.RateLimit().Remaining(time.Now()) == 0 {
+				continue
+			}
+			return segments, err
+		}
+		tiles = tiles[:len(tiles)-1]
+		if resp == nil {
+			continue
+		}
+
+		for _, segment := range resp.Segments {
+			if segment != nil && !seen[segment.ID] {
+				seen[segment.ID] = true
+				segments = append(segments, segment)
+			}
+		}
+
+		if len(resp.Segments) >= explorerLimit && max(tile.NELat-tile.SWLat, tile.NELng-tile.SWLng)/2 >= opts.MinTileSize {
+			for _, q := range tile.quarters() {
+				if opts.Overlaps == nil || opts.Overlaps(q) {
+					tiles = append(tiles, q)
+				}
+			}
+		}
+	}
+
+	return segments, nil
+}
+
+// Blocks until a request can be made within the rate limits, keeping opts.Reserve requests, or
+// returns ErrRateLimitReached when opts.Wait is not set or the window ends after opts.MaxWait.
+func (s *SegmentsService) waitRateLimit(opts ExploreRegionOpts) error {
+	for {
+		r := s.client.RateLimit()
+		if !r.Known() || r.Remaining(time.Now()) > opts.Reserve {
+			return nil
+		}
+		// A second past the reset, so that clocks slightly ahead of Strava's do not retry too early
+		wait := time.Until(r.Reset()) + time.Second
+		if !opts.Wait || opts.MaxWait > 0 && wait > opts.MaxWait {
+			return ErrRateLimitReached
+		}
+		time.Sleep(wait)
+	}
+}
+
+// Returns the four quarters of the bounds, the south-west one last.
+func (b Bounds) quarters() []Bounds {
+	midLat := (b.SWLat + b.NELat) / 2
+	midLng := (b.SWLng + b.NELng) / 2
+	return []Bounds{
+		{SWLat: midLat, SWLng: midLng, NELat: b.NELat, NELng: b.NELng},
+		{SWLat: midLat, SWLng: b.SWLng, NELat: b.NELat, NELng: midLng},
+		{SWLat: b.SWLat, SWLng: midLng, NELat: midLat, NELng: b.NELng},
+		{SWLat: b.SWLat, SWLng: b.SWLng, NELat: midLat, NELng: midLng},
+	}
+}
@@ -178,7 +178,7 @@ func (s *SegmentsService) ListStarredSegments(accessToken string, opts RequestPa
 		params.Set("page", strconv.Itoa(opts.Page))
 	}
 	if opts.PerPage > 0 {
-		params.Set("per_page", strconv.Itoa(opts.Page))
+		params.Set("per_page", strconv.Itoa(opts.PerPage))
 	}
 
 	req, err := s.client.NewRequest(RequestOpts{
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 )
 
 const stravaBaseURL string = "https://www.strava.com/api/v3"
@@ -28,6 +29,9 @@ type Client struct {
 	Segments       *SegmentsService
 	Uploads        *UploadService
 	SegmentEfforts *SegmentEffortsService
+
+	rateLimitMu sync.Mutex
+	rateLimit   RateLimit // The rate limits reported by the last response
 }
 
 type service struct {
@@ -146,6 +150,8 @@ func (c *Client) Do(req *http.Request, v interface{}) error {
 		resp.Body.Close()
 	}()
 
+	c.updateRateLimit(resp.Header)
+
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
 		var errResponse Error
 
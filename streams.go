@@ -1,6 +1,7 @@
 package gostrava
 
 import (
+	"encoding/json"
 	"net/url"
 	"strconv"
 	"strings"
@@ -56,7 +57,7 @@ type LatLngStream struct {
 }
 
 type MovingStream struct {
-	Data []bool // The sequence of moving values for this stream, as boolean values
+	Data []bool `json:"data"` // The sequence of moving values for this stream, as boolean values
 	Stream
 }
 
@@ -85,6 +86,27 @@ type TimeStream struct {
 	Stream
 }
 
+// Builds a StreamSet out of a list of streams, such as the ones returned by GetRouteStreams,
+// keying each stream by its type.
+func NewStreamSet(streams []Stream) (*StreamSet, error) {
+	byType := make(map[string]Stream, len(streams))
+	for _, s := range streams {
+		byType[s.Type] = s
+	}
+
+	data, err := json.Marshal(byType)
+	if err != nil {
+		return nil, err
+	}
+
+	set := new(StreamSet)
+	if err := json.Unmarshal(data, set); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
 // *****************************************************
 
 type StreamsService service
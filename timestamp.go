@@ -24,4 +24,8 @@ func (t *TimeStamp) UnmarshalJSON(data []byte) error {
 	t.Time = parsedTime
 
 	return nil
-}
\ No newline at end of file
+}
+
+func (t TimeStamp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Time.Format(time.RFC3339))
+}
@@ -0,0 +1,116 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/guisaez/gostrava"
+)
+
+// The state of a starred segment as last seen by the watcher.
+type Snapshot struct {
+	SegmentID   int                              `json:"segment_id"`             // The unique identifier of the segment
+	Name        string                           `json:"name"`                   // The name of the segment
+	PR          *gostrava.SummaryPRSegmentEffort `json:"pr,omitempty"`           // The athlete's PR on the segment, if any
+	KOM         string                           `json:"kom,omitempty"`          // The KOM time, as formatted by Strava
+	QOM         string                           `json:"qom,omitempty"`          // The QOM time, as formatted by Strava
+	LocalLegend *gostrava.LocalLegend            `json:"local_legend,omitempty"` // The segment's Local Legend, if any
+	Updated     time.Time                        `json:"updated"`                // When the snapshot was taken
+}
+
+// Returns the snapshot of a segment.
+func NewSnapshot(s *gostrava.SegmentDetailed) *Snapshot {
+	snapshot := &Snapshot{
+		SegmentID:   s.ID,
+		Name:        s.Name,
+		PR:          s.AthletePREffort,
+		LocalLegend: s.LocalLegend,
+		Updated:     time.Now(),
+	}
+	if s.Xoms != nil {
+		snapshot.KOM = s.Xoms.Kom
+		snapshot.QOM = s.Xoms.Qom
+	}
+	return snapshot
+}
+
+// Keeps the snapshots of the watched segments between checks.
+type Store interface {
+	Load(segmentID int) (*Snapshot, error) // Returns the snapshot of a segment, or nil when there is none
+	Save(snapshot *Snapshot) error         // Replaces the snapshot of a segment
+}
+
+// A Store in memory, lost when the program exits. It is safe for concurrent use.
+type MemoryStore struct {
+	mu        sync.Mutex
+	snapshots map[int]*Snapshot
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{snapshots: map[int]*Snapshot{}}
+}
+
+func (m *MemoryStore) Load(segmentID int) (*Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshots[segmentID], nil
+}
+
+func (m *MemoryStore) Save(snapshot *Snapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshots[snapshot.SegmentID] = snapshot
+	return nil
+}
+
+// A Store keeping each snapshot as a JSON file, {segment ID}.json, in a directory.
+type FileStore struct {
+	Dir string // The directory of the snapshots, created when needed
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{Dir: dir}
+}
+
+func (f *FileStore) path(segmentID int) string {
+	return filepath.Join(f.Dir, strconv.Itoa(segmentID)+".json")
+}
+
+func (f *FileStore) Load(segmentID int) (*Snapshot, error) {
+	data, err := os.ReadFile(f.path(segmentID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := new(Snapshot)
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Saves the snapshot through a temporary file, so that an interrupted write does not lose the previous one.
+func (f *FileStore) Save(snapshot *Snapshot) error {
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	path := f.path(snapshot.SegmentID)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
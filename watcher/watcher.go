@@ -0,0 +1,229 @@
+// Package watcher polls the authenticated athlete's starred segments and reports changes to their
+// PR, KOM and QOM times and Local Legend, compared to snapshots kept in a Store.
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/guisaez/gostrava"
+)
+
+const (
+	defaultInterval = time.Hour
+	starredPerPage  = 200 // The largest page size accepted by Strava
+)
+
+type EventType string
+
+const (
+	NewPR              EventType = "new_pr"               // The athlete set a new PR on the segment
+	KOMChanged         EventType = "kom_changed"          // The KOM time changed
+	QOMChanged         EventType = "qom_changed"          // The QOM time changed
+	LocalLegendGained  EventType = "local_legend_gained"  // The athlete became the segment's Local Legend
+	LocalLegendLost    EventType = "local_legend_lost"    // The athlete is no longer the segment's Local Legend
+	LocalLegendChanged EventType = "local_legend_changed" // The segment's Local Legend changed, between other athletes
+)
+
+type Event struct {
+	Type     EventType                 // The type of change
+	Segment  *gostrava.SegmentDetailed // The segment, as just fetched
+	Previous *Snapshot                 // The snapshot before the change
+	Current  *Snapshot                 // The snapshot after the change
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%s on segment %d (%s)", e.Type, e.Current.SegmentID, e.Current.Name)
+}
+
+type Opts struct {
+	Interval  time.Duration                       // The time between checks made by Run. Defaults to an hour
+	Store     Store                               // Where snapshots are kept. Defaults to a MemoryStore
+	AthleteID int                                 // The authenticated athlete, to tell LocalLegendGained and LocalLegendLost from LocalLegendChanged
+	Token     func() (string, error)              // Returns the access token before each check, such as one refreshed with oauth2. Overrides the watcher's token when set
+	OnEvent   func(Event)                         // Called with every event, if set
+	Events    chan<- Event                        // Receives every event, if set. Sends block until received or the context is done
+	OnError   func(error)                         // Called with the errors of the checks made by Run, if set
+	Filter    func(*gostrava.SegmentSummary) bool // Only watches the starred segments it returns true for, if set
+}
+
+type Watcher struct {
+	segments    *gostrava.SegmentsService
+	accessToken string
+	opts        Opts
+}
+
+// Returns a watcher of the starred segments of the athlete authenticated by accessToken.
+func New(segments *gostrava.SegmentsService, accessToken string, opts Opts) *Watcher {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	return &Watcher{segments: segments, accessToken: accessToken, opts: opts}
+}
+
+// Checks every starred segment once: lists them, fetches each with GetById, compares it with its
+// snapshot, then saves the new one. The first check of a segment only records its snapshot.
+// Events are returned as well as delivered to OnEvent and Events. A segment that fails does not stop
+// the others; the errors are returned joined. Each check makes one request per starred segment, plus
+// one per page of them, which counts against the application's rate limits.
+func (w *Watcher) Check(ctx context.Context) ([]Event, error) {
+	token := w.accessToken
+	if w.opts.Token != nil {
+		var err error
+		if token, err = w.opts.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	starred, err := w.starred(token)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []Event{}
+	var errs []error
+	for i := range starred {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+		if w.opts.Filter != nil && !w.opts.Filter(&starred[i]) {
+			continue
+		}
+
+		segmentEvents, current, err := w.checkSegment(token, starred[i].ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("segment %d: %w", starred[i].ID, err))
+			continue
+		}
+		for _, e := range segmentEvents {
+			if err := w.emit(ctx, e); err != nil {
+				return events, err
+			}
+			events = append(events, e)
+		}
+
+		// Saved once its events are delivered, so that they are reported again if the watcher stops before
+		if err := w.opts.Store.Save(current); err != nil {
+			errs = append(errs, fmt.Errorf("segment %d: %w", starred[i].ID, err))
+		}
+	}
+
+	return events, errors.Join(errs...)
+}
+
+// Checks the starred segments every Interval, starting immediately, until the context is done.
+// Errors are passed to OnError and do not stop the watcher. Returns the context's error.
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.Check(ctx); err != nil && w.opts.OnError != nil && ctx.Err() == nil {
+			w.opts.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Returns all the starred segments, page by page.
+func (w *Watcher) starred(token string) ([]gostrava.SegmentSummary, error) {
+	starred := []gostrava.SegmentSummary{}
+	for page := 1; ; page++ {
+		list, err := w.segments.ListStarredSegments(token, gostrava.RequestParams{Page: page, PerPage: starredPerPage})
+		if err != nil {
+			return nil, err
+		}
+		starred = append(starred, list...)
+		if len(list) < starredPerPage {
+			return starred, nil
+		}
+	}
+}
+
+// Returns the changes of a segment since its snapshot, along with its new snapshot.
+func (w *Watcher) checkSegment(token string, id int) ([]Event, *Snapshot, error) {
+	segment, err := w.segments.GetById(token, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	previous, err := w.opts.Store.Load(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	current := NewSnapshot(segment)
+
+	events := []Event{}
+	if previous != nil {
+		for _, t := range w.diff(previous, current) {
+			events = append(events, Event{Type: t, Segment: segment, Previous: previous, Current: current})
+		}
+	}
+
+	return events, current, nil
+}
+
+// Returns the types of the changes between two snapshots of a segment.
+func (w *Watcher) diff(previous, current *Snapshot) []EventType {
+	types := []EventType{}
+
+	if pr := current.PR; pr != nil && pr.PRElapsedTime > 0 {
+		old := previous.PR
+		if old == nil || old.PRElapsedTime == 0 || pr.PRActivityID != old.PRActivityID && pr.PRElapsedTime <= old.PRElapsedTime {
+			types = append(types, NewPR)
+		}
+	}
+
+	if current.KOM != previous.KOM && current.KOM != "" {
+		types = append(types, KOMChanged)
+	}
+	if current.QOM != previous.QOM && current.QOM != "" {
+		types = append(types, QOMChanged)
+	}
+
+	was, is := legend(previous.LocalLegend), legend(current.LocalLegend)
+	switch {
+	case was == is:
+	case w.opts.AthleteID != 0 && is == w.opts.AthleteID:
+		types = append(types, LocalLegendGained)
+	case w.opts.AthleteID != 0 && was == w.opts.AthleteID:
+		types = append(types, LocalLegendLost)
+	default:
+		types = append(types, LocalLegendChanged)
+	}
+
+	return types
+}
+
+// Returns the athlete holding the Local Legend, 0 when there is none.
+func legend(l *gostrava.LocalLegend) int {
+	if l == nil {
+		return 0
+	}
+	return l.AthleteID
+}
+
+func (w *Watcher) emit(ctx context.Context, e Event) error {
+	if w.opts.OnEvent != nil {
+		w.opts.OnEvent(e)
+	}
+	if w.opts.Events != nil {
+		select {
+		case w.opts.Events <- e:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}